@@ -128,10 +128,8 @@ func invoke(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 		return shim.Error("目标账户查询错误")
 	}
 	if bv == nil {
-		err = stub.PutState(args[1], []byte(args[2]))
-		if err != nil {
-			return shim.Error("目标账户更新错误")
-		}
+		//目标账户不存在时以转账金额开户
+		tarv = v
 	} else {
 		tarv, err = strconv.Atoi(string(bv))
 		if err != nil {
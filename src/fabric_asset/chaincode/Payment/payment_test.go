@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"testing"
+)
+
+func checkBalance(t *testing.T, stub *shim.MockStub, account string, expected string) {
+	res := stub.MockInvoke("query", [][]byte{[]byte("query"), []byte(account)})
+	if res.Status != shim.OK || string(res.Payload) != expected {
+		t.Errorf("账户%s的余额为%s（%s），应为%s", account, res.Payload, res.Message, expected)
+	}
+}
+
+func TestInvokeToNewAccount(t *testing.T) {
+	stub := shim.NewMockStub("payment", new(PaymentChaincode))
+	res := stub.MockInit("tx1", [][]byte{[]byte("init"), []byte("a"), []byte("100"), []byte("b"), []byte("0")})
+	if res.Status != shim.OK {
+		t.Fatalf("初始化失败：%s", res.Message)
+	}
+
+	//目标账户不存在时开户
+	res = stub.MockInvoke("tx2", [][]byte{[]byte("invoke"), []byte("a"), []byte("c"), []byte("30")})
+	if res.Status != shim.OK {
+		t.Fatalf("转账失败：%s", res.Message)
+	}
+	checkBalance(t, stub, "a", "70")
+	checkBalance(t, stub, "c", "30")
+
+	res = stub.MockInvoke("tx3", [][]byte{[]byte("invoke"), []byte("a"), []byte("c"), []byte("20")})
+	if res.Status != shim.OK {
+		t.Fatalf("转账失败：%s", res.Message)
+	}
+	checkBalance(t, stub, "a", "50")
+	checkBalance(t, stub, "c", "50")
+}
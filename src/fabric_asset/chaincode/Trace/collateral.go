@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//抵押物
+//抵押物登记到贷款上，同一抵押物不能同时担保两笔未结清的贷款，贷款还清后自动解除
+
+//抵押物状态
+const (
+	Collateral_Status_Pledged  = 1
+	Collateral_Status_Released = 2
+)
+
+//抵押物的key
+func constructCollateralKey(stub shim.ChaincodeStubInterface, collateralID string) (string, error) {
+	return stub.CreateCompositeKey("collateral", []string{collateralID})
+}
+
+//查询抵押物
+func getCollateral(stub shim.ChaincodeStubInterface, collateralID string) (Collateral, bool) {
+	var c Collateral
+	key, err := constructCollateralKey(stub, collateralID)
+	if err != nil {
+		return c, false
+	}
+	b, err := stub.GetState(key)
+	if err != nil || b == nil {
+		return c, false
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, false
+	}
+	return c, true
+}
+
+//保存抵押物
+func putCollateral(stub shim.ChaincodeStubInterface, c Collateral) error {
+	key, err := constructCollateralKey(stub, c.CollateralID)
+	if err != nil {
+		return fmt.Errorf("创建key失败 %s", err)
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("序列化抵押物失败")
+	}
+	if err := stub.PutState(key, b); err != nil {
+		return fmt.Errorf("保存抵押物失败 %s", err)
+	}
+	return nil
+}
+
+//贷款是否未结清：未被拒绝、重组或核销，且未放款或放款后还有未还金额
+func isLoanActive(l Loan) bool {
+	if l.Status == Loan_Status_Rejected || l.Status == Loan_Status_Restructured || l.Status == Loan_Status_WrittenOff {
+		return false
+	}
+	if l.Status == Loan_Status_Disbursed && l.Balance <= 0 {
+		return false
+	}
+	return true
+}
+
+//登记抵押物
+//-c '{"Args":["attachCollateral","贷款编号","{\"CollateralID\":\"\",\"Type\":\"\",\"AppraisedValue\":0,\"DocHash\":\"\"}"]}'
+//由贷款所属银行提交，抵押物已解除或担保的贷款已结清时可以重新登记
+func attachCollateral(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 2 {
+		return shim.Error("参数个数错误")
+	}
+	l, ok := getLoan(stub, args[0])
+	if !ok {
+		return shim.Error("贷款不存在")
+	}
+	if err := checkBankPermission(stub, l.BankName); err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isLoanActive(l) {
+		return shim.Error("贷款已结清或已拒绝")
+	}
+
+	var c Collateral
+	if err := json.Unmarshal([]byte(args[1]), &c); err != nil {
+		return shim.Error("抵押物解析失败")
+	}
+	if c.CollateralID == "" || c.Type == "" {
+		return shim.Error("抵押物编号和类型不能为空")
+	}
+	if c.AppraisedValue <= 0 {
+		return shim.Error("评估价值必须大于0")
+	}
+	if hash, err := hex.DecodeString(c.DocHash); err != nil || len(hash) != 32 {
+		return shim.Error("文件哈希必须是sha256的十六进制")
+	}
+
+	//同一抵押物不能在一笔贷款上重复登记
+	for _, collateralID := range l.Collaterals {
+		if collateralID == c.CollateralID {
+			return shim.Error("抵押物已登记在该贷款上")
+		}
+	}
+	//同一抵押物不能同时担保两笔未结清的贷款
+	if exist, ok := getCollateral(stub, c.CollateralID); ok && exist.Status == Collateral_Status_Pledged {
+		pledged, ok := getLoan(stub, exist.LoanID)
+		if !ok || isLoanActive(pledged) {
+			return shim.Error(fmt.Sprintf("抵押物已担保贷款：%s", exist.LoanID))
+		}
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	c.LoanID = l.LoanID
+	c.Status = Collateral_Status_Pledged
+	c.PledgeTxID = stub.GetTxID()
+	c.PledgeTime = txTime.Format(Time_Layout)
+	c.ReleaseTxID = ""
+	c.ReleaseTime = ""
+	if err := putCollateral(stub, c); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	l.Collaterals = append(l.Collaterals, c.CollateralID)
+	if !putLoan(stub, l) {
+		return shim.Error("保存贷款失败")
+	}
+	return shim.Success([]byte("登记抵押物成功"))
+}
+
+//解除贷款的所有抵押物
+func releaseCollaterals(stub shim.ChaincodeStubInterface, l Loan) error {
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	for _, collateralID := range l.Collaterals {
+		c, ok := getCollateral(stub, collateralID)
+		//抵押物已经改为担保其他贷款
+		if !ok || c.LoanID != l.LoanID || c.Status != Collateral_Status_Pledged {
+			continue
+		}
+		c.Status = Collateral_Status_Released
+		c.ReleaseTxID = stub.GetTxID()
+		c.ReleaseTime = txTime.Format(Time_Layout)
+		if err := putCollateral(stub, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//重组时把原贷款的抵押物转为担保新贷款
+func transferCollaterals(stub shim.ChaincodeStubInterface, from *Loan, to *Loan) error {
+	for _, collateralID := range from.Collaterals {
+		c, ok := getCollateral(stub, collateralID)
+		if !ok || c.LoanID != from.LoanID || c.Status != Collateral_Status_Pledged {
+			continue
+		}
+		c.LoanID = to.LoanID
+		if err := putCollateral(stub, c); err != nil {
+			return err
+		}
+		to.Collaterals = append(to.Collaterals, collateralID)
+	}
+	return nil
+}
+
+//抵押物查询
+//-c '{"Args":["queryCollateral","抵押物编号"]}'
+func queryCollateral(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 1 {
+		return shim.Error("参数个数错误")
+	}
+	c, ok := getCollateral(stub, args[0])
+	if !ok {
+		return shim.Error("抵押物不存在")
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return shim.Error("序列化失败")
+	}
+	return shim.Success(b)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+//抵押物参数，证明文件的哈希取编号的sha256
+func collateralArg(t *testing.T, collateralID string) string {
+	sum := sha256.Sum256([]byte(collateralID))
+	b, err := json.Marshal(Collateral{
+		CollateralID:   collateralID,
+		Type:           "房产",
+		AppraisedValue: 500000,
+		DocHash:        hex.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCollateralPledgeAndRelease(t *testing.T) {
+	s, accountKey, loanID := setupAccount(t)
+	s.mustInvoke("attachCollateral", loanID, collateralArg(t, "H1"))
+	c, _ := getCollateral(s, "H1")
+	if c.LoanID != loanID || c.Status != Collateral_Status_Pledged || c.PledgeTxID == "" {
+		t.Errorf("抵押物登记错误：%+v", c)
+	}
+
+	//同一贷款重复登记
+	expectRefused(t, "attachCollateral", s.invoke("attachCollateral", loanID, collateralArg(t, "H1")))
+	if l, _ := getLoan(s, loanID); len(l.Collaterals) != 1 {
+		t.Errorf("抵押物不应重复登记：%v", l.Collaterals)
+	}
+	//已担保未结清贷款的抵押物不能担保其他贷款
+	other := s.openLoan("ICBCMSP", "icbc", accountKey, 3000, 3)
+	expectRefused(t, "attachCollateral", s.invoke("attachCollateral", other, collateralArg(t, "H1")))
+	//其他银行不能登记
+	s.as("CCBMSP", "teller")
+	expectRefused(t, "attachCollateral", s.invoke("attachCollateral", loanID, collateralArg(t, "H2")))
+	s.as("ICBCMSP", "teller")
+	expectRefused(t, "attachCollateral", s.invoke("attachCollateral", loanID, `{"CollateralID":"H2","Type":"房产","AppraisedValue":1,"DocHash":"abc"}`))
+
+	//还清后解除
+	s.at("2018-06-20 10:00:00")
+	s.mustInvoke("repayment", accountKey, "icbc", "12780", loanID)
+	c, _ = getCollateral(s, "H1")
+	if c.Status != Collateral_Status_Released || c.ReleaseTime != "2018-06-20 10:00:00" || c.ReleaseTxID == "" {
+		t.Errorf("还清后抵押物应解除：%+v", c)
+	}
+	//已结清的贷款不能再登记，解除的抵押物可以担保其他贷款
+	expectRefused(t, "attachCollateral", s.invoke("attachCollateral", loanID, collateralArg(t, "H2")))
+	s.mustInvoke("attachCollateral", other, collateralArg(t, "H1"))
+	c, _ = getCollateral(s, "H1")
+	if c.LoanID != other || c.Status != Collateral_Status_Pledged || c.ReleaseTxID != "" {
+		t.Errorf("重新登记的抵押物错误：%+v", c)
+	}
+}
+
+func TestCollateralReleasedOnRejection(t *testing.T) {
+	s, accountKey, _ := setupAccount(t)
+	loanID := string(s.mustInvoke("applyLoan", accountKey, "icbc", "3000", "1200", "3", "1", "消费贷款").Payload)
+	s.mustInvoke("attachCollateral", loanID, collateralArg(t, "C1"))
+	s.mustInvoke("rejectLoan", loanID, "资料不全")
+	if c, _ := getCollateral(s, "C1"); c.Status != Collateral_Status_Released {
+		t.Errorf("拒绝后抵押物应解除：%+v", c)
+	}
+	expectRefused(t, "attachCollateral", s.invoke("attachCollateral", loanID, collateralArg(t, "C2")))
+}
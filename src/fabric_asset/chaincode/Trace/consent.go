@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"time"
+)
+
+//客户授权
+//银行查询客户的跨行数据前，客户需要用自己的身份授权给该银行
+//客户身份由银行在开户时绑定到账户
+
+//授权范围
+const (
+	Consent_Scope_History = "history"
+	Consent_Scope_Report  = "report"
+	Consent_Scope_All     = "all"
+)
+
+//客户身份的key
+func constructCustomerKey(stub shim.ChaincodeStubInterface, accountKey string) (string, error) {
+	return stub.CreateCompositeKey("customer", []string{accountKey})
+}
+
+//查询账户绑定的客户身份
+func getCustomerIdentity(stub shim.ChaincodeStubInterface, accountKey string) (string, bool) {
+	key, err := constructCustomerKey(stub, accountKey)
+	if err != nil {
+		return "", false
+	}
+	b, err := stub.GetState(key)
+	if err != nil || b == nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+//绑定客户身份
+//-c '{"Args":["bindCustomer","账户key","银行名字","客户身份(MSP ID/证书名)"]}'
+//由与账户有往来的银行提交，绑定后不能更改
+func bindCustomer(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 3 {
+		return shim.Error("参数个数错误")
+	}
+	if args[2] == "" {
+		return shim.Error("客户身份不能为空")
+	}
+	accountKey, err := resolveAccountKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkBankPermission(stub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	//否则任何银行都可以把自己绑定为客户，再给自己授权
+	account, exist, err := getAccount(stub, accountKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !exist || !hasBank(account, args[1]) {
+		return shim.Error("账户在该银行没有贷款")
+	}
+	if _, ok := getCustomerIdentity(stub, accountKey); ok {
+		return shim.Error("客户身份已绑定")
+	}
+	key, err := constructCustomerKey(stub, accountKey)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("创建key失败 %s", err))
+	}
+	if err := stub.PutState(key, []byte(args[2])); err != nil {
+		return shim.Error(fmt.Sprintf("保存客户身份失败 %s", err))
+	}
+	return shim.Success([]byte("绑定客户身份成功"))
+}
+
+//校验提交者是否为该客户本人
+func checkCustomerPermission(stub shim.ChaincodeStubInterface, accountKey string) error {
+	customer, ok := getCustomerIdentity(stub, accountKey)
+	if !ok {
+		return fmt.Errorf("客户身份未绑定")
+	}
+	identity, err := getCreatorIdentity(stub)
+	if err != nil {
+		return err
+	}
+	if identity != customer {
+		return fmt.Errorf("只有客户本人可以进行该操作")
+	}
+	return nil
+}
+
+//授权的key
+func constructConsentKey(stub shim.ChaincodeStubInterface, accountKey string, bankName string) (string, error) {
+	return stub.CreateCompositeKey("consent", []string{accountKey, bankName})
+}
+
+//授权银行查询
+//-c '{"Args":["grantConsent","账户key","银行名字","授权范围(history/report/all)","到期时间(2006-01-02 15:04:05)"]}'
+//同一家银行再次授权时覆盖之前的授权
+func grantConsent(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 4 {
+		return shim.Error("参数个数错误")
+	}
+	accountKey, err := resolveAccountKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	bankName := args[1]
+	scope := args[2]
+	if scope != Consent_Scope_History && scope != Consent_Scope_Report && scope != Consent_Scope_All {
+		return shim.Error("授权范围错误")
+	}
+	if err := checkCustomerPermission(stub, accountKey); err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, ok := getBankRegistry(stub, bankName); !ok {
+		return shim.Error("银行未登记")
+	}
+	expire, err := time.Parse(Time_Layout, args[3])
+	if err != nil {
+		return shim.Error("到期时间格式错误")
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !expire.After(txTime) {
+		return shim.Error("到期时间必须晚于当前时间")
+	}
+	identity, err := getCreatorIdentity(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	consent := Consent{
+		AccountKey: accountKey,
+		BankName:   bankName,
+		Scope:      scope,
+		ExpireTime: args[3],
+		GrantedBy:  identity,
+		TxID:       stub.GetTxID(),
+		Time:       txTime.Format(Time_Layout),
+	}
+	if err := putConsent(stub, consent); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte("授权成功"))
+}
+
+//撤销授权
+//-c '{"Args":["revokeConsent","账户key","银行名字"]}'
+func revokeConsent(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 2 {
+		return shim.Error("参数个数错误")
+	}
+	accountKey, err := resolveAccountKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkCustomerPermission(stub, accountKey); err != nil {
+		return shim.Error(err.Error())
+	}
+	consent, ok := getConsent(stub, accountKey, args[1])
+	if !ok {
+		return shim.Error("授权不存在")
+	}
+	consent.Revoked = true
+	if err := putConsent(stub, consent); err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success([]byte("撤销授权成功"))
+}
+
+//查询客户的所有授权
+//-c '{"Args":["queryConsents","账户key"]}'
+//只有客户本人可以查询
+func queryConsents(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 1 {
+		return shim.Error("参数个数错误")
+	}
+	accountKey, err := resolveAccountKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkCustomerPermission(stub, accountKey); err != nil {
+		return shim.Error(err.Error())
+	}
+	consents, err := getConsents(stub, accountKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	b, err := json.Marshal(consents)
+	if err != nil {
+		return shim.Error("序列化失败")
+	}
+	return shim.Success(b)
+}
+
+//保存授权
+func putConsent(stub shim.ChaincodeStubInterface, consent Consent) error {
+	key, err := constructConsentKey(stub, consent.AccountKey, consent.BankName)
+	if err != nil {
+		return fmt.Errorf("创建key失败 %s", err)
+	}
+	b, err := json.Marshal(consent)
+	if err != nil {
+		return fmt.Errorf("序列化授权失败")
+	}
+	if err := stub.PutState(key, b); err != nil {
+		return fmt.Errorf("保存授权失败 %s", err)
+	}
+	return nil
+}
+
+//查询客户对某家银行的授权
+func getConsent(stub shim.ChaincodeStubInterface, accountKey string, bankName string) (Consent, bool) {
+	var consent Consent
+	key, err := constructConsentKey(stub, accountKey, bankName)
+	if err != nil {
+		return consent, false
+	}
+	b, err := stub.GetState(key)
+	if err != nil || b == nil {
+		return consent, false
+	}
+	if err := json.Unmarshal(b, &consent); err != nil {
+		return consent, false
+	}
+	return consent, true
+}
+
+//查询客户的所有授权
+func getConsents(stub shim.ChaincodeStubInterface, accountKey string) ([]Consent, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("consent", []string{accountKey})
+	if err != nil {
+		return nil, fmt.Errorf("查询授权失败")
+	}
+	defer resultsIterator.Close()
+
+	consents := make([]Consent, 0)
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("遍历授权失败")
+		}
+		var consent Consent
+		if err := json.Unmarshal(kv.Value, &consent); err != nil {
+			return nil, fmt.Errorf("反序列化授权失败")
+		}
+		consents = append(consents, consent)
+	}
+	return consents, nil
+}
+
+//校验提交者能否查询客户数据
+//客户本人可以直接查询；银行需要客户对该银行MSP下的某家银行有未过期、未撤销且范围匹配的授权
+func checkConsent(stub shim.ChaincodeStubInterface, accountKey string, scope string) error {
+	if err := checkCustomerPermission(stub, accountKey); err == nil {
+		return nil
+	}
+	mspID, err := getCreatorMSP(stub)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+	consents, err := getConsents(stub, accountKey)
+	if err != nil {
+		return err
+	}
+	for _, consent := range consents {
+		if consent.Revoked || (consent.Scope != scope && consent.Scope != Consent_Scope_All) {
+			continue
+		}
+		expire, err := time.Parse(Time_Layout, consent.ExpireTime)
+		if err != nil || !expire.After(txTime) {
+			continue
+		}
+		registry, ok := getBankRegistry(stub, consent.BankName)
+		if ok && registry.MSPID == mspID {
+			return nil
+		}
+	}
+	return fmt.Errorf("客户未授权该银行查询")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"strings"
+	"testing"
+)
+
+const (
+	testRegulatorMSP = "RegulatorMSP"
+	testCustomerMSP  = "CustomerMSP"
+	testCardNo       = "110101199001011234"
+	testSalt         = "salt"
+)
+
+//登记icbc和ccb两家银行，icbc为客户开户并放款一笔，返回账户key和贷款编号
+//等额本金，月利率1%，12000元12期，应还12780
+func setupAccount(t *testing.T) (*testStub, string, string) {
+	s := newTestStub(t)
+	if res := s.as(testRegulatorMSP, "admin").init(testRegulatorMSP); res.Status != shim.OK {
+		t.Fatalf("初始化失败：%s", res.Message)
+	}
+	s.mustInvoke("registerBank", "icbc", "ICBCMSP")
+	s.mustInvoke("registerBank", "ccb", "CCBMSP")
+
+	s.as("ICBCMSP", "teller").withTransient(map[string][]byte{
+		"CardNo": []byte(testCardNo),
+		"salt":   []byte(testSalt),
+	})
+	loanID := string(s.mustInvoke("applyLoan", "", "icbc", "12000", "1200", "12", "1", "消费贷款").Payload)
+	s.withTransient(nil)
+	s.mustInvoke("reviewLoan", loanID, "资料齐全")
+	s.mustInvoke("approveLoan", loanID, "同意")
+	s.mustInvoke("disburseLoan", loanID, "放款")
+	return s, hashAccountKey(testCardNo, testSalt), loanID
+}
+
+//在setupAccount的基础上由icbc绑定客户身份
+func setupConsent(t *testing.T) (*testStub, string) {
+	s, accountKey, _ := setupAccount(t)
+	s.mustInvoke("bindCustomer", accountKey, "icbc", testCustomerMSP+"/alice")
+	return s, accountKey
+}
+
+func expectRefused(t *testing.T, name string, res pb.Response) {
+	if res.Status == shim.OK {
+		t.Errorf("%s 应被拒绝", name)
+	}
+}
+
+func TestConsentGatesAccountQueries(t *testing.T) {
+	s, accountKey := setupConsent(t)
+
+	//未授权的银行不能查询
+	s.as("CCBMSP", "teller")
+	expectRefused(t, "queryLoans", s.invoke("queryLoans", accountKey))
+	expectRefused(t, "queryAccountBanks", s.invoke("queryAccountBanks", accountKey))
+
+	//客户本人可以直接查询
+	s.as(testCustomerMSP, "alice")
+	s.mustInvoke("queryLoans", accountKey)
+
+	//授权范围不匹配仍然不能查询
+	s.mustInvoke("grantConsent", accountKey, "ccb", Consent_Scope_Report, "2019-01-01 00:00:00")
+	s.as("CCBMSP", "teller")
+	expectRefused(t, "queryLoans", s.invoke("queryLoans", accountKey))
+
+	//授权后可以查询
+	s.as(testCustomerMSP, "alice")
+	s.mustInvoke("grantConsent", accountKey, "ccb", Consent_Scope_History, "2019-01-01 00:00:00")
+	s.as("CCBMSP", "teller")
+	res := s.mustInvoke("queryLoans", accountKey)
+	var loans []Loan
+	if err := json.Unmarshal(res.Payload, &loans); err != nil {
+		t.Fatal(err)
+	}
+	if len(loans) != 1 || loans[0].BankName != "icbc" {
+		t.Errorf("查询到的贷款错误：%+v", loans)
+	}
+	s.mustInvoke("queryAccountBanks", accountKey)
+
+	//撤销后不能再查询
+	s.as(testCustomerMSP, "alice")
+	s.mustInvoke("revokeConsent", accountKey, "ccb")
+	s.as("CCBMSP", "teller")
+	expectRefused(t, "queryLoans", s.invoke("queryLoans", accountKey))
+	expectRefused(t, "queryAccountBanks", s.invoke("queryAccountBanks", accountKey))
+}
+
+func TestBankQueriesLimitedToOwnBank(t *testing.T) {
+	s, _ := setupConsent(t)
+
+	s.as("CCBMSP", "teller")
+	expectRefused(t, "queryDelinquent", s.invoke("queryDelinquent", "", "icbc"))
+	expectRefused(t, "queryDelinquent", s.invoke("queryDelinquent", "", ""))
+	expectRefused(t, "queryBankAccounts", s.invoke("queryBankAccounts", "icbc"))
+	expectRefused(t, "searchLoans", s.invoke("searchLoans", `{"BankName":"icbc","PageSize":10}`))
+	expectRefused(t, "searchLoans", s.invoke("searchLoans", `{"PageSize":10}`))
+	s.mustInvoke("queryDelinquent", "", "ccb")
+	s.mustInvoke("queryBankAccounts", "ccb")
+
+	s.as("ICBCMSP", "teller")
+	s.mustInvoke("queryDelinquent", "", "icbc")
+	s.mustInvoke("queryBankAccounts", "icbc")
+	//富查询需要CouchDB，MockStub不支持，只检查不是因为权限被拒绝
+	if res := s.invoke("searchLoans", `{"BankName":"icbc","PageSize":10}`); strings.Contains(res.Message, "无权") {
+		t.Errorf("银行查询自己的贷款被拒绝：%s", res.Message)
+	}
+
+	s.as(testRegulatorMSP, "admin")
+	s.mustInvoke("queryDelinquent", "", "")
+	s.mustInvoke("queryDelinquent", "", "icbc")
+}
+
+func TestBindCustomerRequiresBankRelationship(t *testing.T) {
+	s, accountKey, _ := setupAccount(t)
+
+	//ccb与该账户没有往来，不能把自己绑定为客户再给自己授权
+	s.as("CCBMSP", "teller")
+	expectRefused(t, "bindCustomer", s.invoke("bindCustomer", accountKey, "ccb", "CCBMSP/teller"))
+	//冒用icbc的名字
+	expectRefused(t, "bindCustomer", s.invoke("bindCustomer", accountKey, "icbc", "CCBMSP/teller"))
+	expectRefused(t, "grantConsent", s.invoke("grantConsent", accountKey, "ccb", Consent_Scope_All, "2019-01-01 00:00:00"))
+	expectRefused(t, "queryLoans", s.invoke("queryLoans", accountKey))
+
+	//只申请未放款也不算往来
+	s.mustInvoke("applyLoan", accountKey, "ccb", "1000", "1200", "12", "1", "消费贷款")
+	expectRefused(t, "bindCustomer", s.invoke("bindCustomer", accountKey, "ccb", "CCBMSP/teller"))
+	//账户不存在
+	expectRefused(t, "bindCustomer", s.invoke("bindCustomer", hashAccountKey("110101199001015678", testSalt), "ccb", "CCBMSP/teller"))
+
+	//放款的银行可以绑定，绑定后不能更改
+	s.as("ICBCMSP", "teller")
+	s.mustInvoke("bindCustomer", accountKey, "icbc", testCustomerMSP+"/alice")
+	expectRefused(t, "bindCustomer", s.invoke("bindCustomer", accountKey, "icbc", "ICBCMSP/teller"))
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"time"
+)
+
+//逾期分类
+//按最早一期逾期未还的天数分档，并维护delinquency~bank~loan索引
+
+const (
+	Delinquency_1_30   = "1-30"
+	Delinquency_31_90  = "31-90"
+	Delinquency_Over90 = "90+"
+)
+
+//所有逾期分档，按逾期天数从少到多
+var delinquencyBuckets = []string{Delinquency_1_30, Delinquency_31_90, Delinquency_Over90}
+
+//逾期天数对应的分档，未逾期为空
+func delinquencyBucket(days int) string {
+	if days <= 0 {
+		return ""
+	} else if days <= 30 {
+		return Delinquency_1_30
+	} else if days <= 90 {
+		return Delinquency_31_90
+	}
+	return Delinquency_Over90
+}
+
+//最早一期逾期未还的天数
+func daysPastDue(l Loan, t time.Time) int {
+	for _, inst := range l.Schedule {
+		if inst.Status != Installment_Status_Overdue {
+			continue
+		}
+		due, err := time.Parse(Date_Layout, inst.DueDate)
+		if err != nil {
+			continue
+		}
+		return int(t.Sub(due).Hours() / 24)
+	}
+	return 0
+}
+
+//重新计算贷款的逾期状态，分档变化时更新索引
+//返回贷款是否有变化
+func classifyLoan(stub shim.ChaincodeStubInterface, l *Loan, t time.Time) (bool, error) {
+	before, err := json.Marshal(l)
+	if err != nil {
+		return false, fmt.Errorf("序列化贷款失败")
+	}
+	oldBucket := l.Delinquency
+
+	if l.Status == Loan_Status_Restructured || l.Status == Loan_Status_WrittenOff {
+		//已重组或核销的贷款保留原还款计划，不再计算逾期
+		l.DaysPastDue = 0
+		l.Delinquency = ""
+	} else {
+		refreshSchedule(l, t)
+		l.DaysPastDue = daysPastDue(*l, t)
+		l.Delinquency = delinquencyBucket(l.DaysPastDue)
+	}
+
+	if oldBucket != l.Delinquency {
+		if oldBucket != "" {
+			key, err := stub.CreateCompositeKey("delinquency~bank~loan", []string{oldBucket, l.BankName, l.LoanID})
+			if err != nil {
+				return false, fmt.Errorf("创建key失败 %s", err)
+			}
+			if err := stub.DelState(key); err != nil {
+				return false, fmt.Errorf("删除逾期索引失败 %s", err)
+			}
+		}
+		if l.Delinquency != "" {
+			key, err := stub.CreateCompositeKey("delinquency~bank~loan", []string{l.Delinquency, l.BankName, l.LoanID})
+			if err != nil {
+				return false, fmt.Errorf("创建key失败 %s", err)
+			}
+			if err := stub.PutState(key, []byte{0x00}); err != nil {
+				return false, fmt.Errorf("保存逾期索引失败 %s", err)
+			}
+		}
+	}
+
+	after, err := json.Marshal(l)
+	if err != nil {
+		return false, fmt.Errorf("序列化贷款失败")
+	}
+	return string(before) != string(after), nil
+}
+
+//逾期检查
+//-c '{"Args":["markOverdue","银行名字(可为空)"]}'
+//按交易时间检查贷款各期是否逾期；指定银行时由该银行提交，不指定时由监管机构提交
+func markOverdue(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) > 1 {
+		return shim.Error("参数个数错误")
+	}
+	bankName := ""
+	if len(args) == 1 {
+		bankName = args[0]
+	}
+
+	var loanIDs []string
+	var err error
+	if bankName != "" {
+		if err := checkBankPermission(stub, bankName); err != nil {
+			return shim.Error(err.Error())
+		}
+		loanIDs, err = getBankLoanIDs(stub, bankName)
+	} else {
+		if err := checkRegulatorPermission(stub); err != nil {
+			return shim.Error(err.Error())
+		}
+		loanIDs, err = getAllLoanIDs(stub)
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	count := 0
+	for _, loanID := range loanIDs {
+		l, ok := getLoan(stub, loanID)
+		if !ok {
+			return shim.Error("查询贷款失败")
+		}
+		changed, err := classifyLoan(stub, &l, txTime)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !changed {
+			continue
+		}
+		if !putLoan(stub, l) {
+			return shim.Error("保存贷款失败")
+		}
+		count++
+	}
+	return shim.Success([]byte(fmt.Sprintf("逾期检查完成，更新%d笔贷款", count)))
+}
+
+//逾期贷款查询
+//-c '{"Args":["queryDelinquent","逾期分档(1-30/31-90/90+，可为空)","银行名字(可为空)"]}'
+//银行只能查询自己的逾期贷款，不传银行名字时只有监管机构可以查询
+func queryDelinquent(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) > 2 {
+		return shim.Error("参数个数错误")
+	}
+	buckets := delinquencyBuckets
+	if len(args) > 0 && args[0] != "" {
+		valid := false
+		for _, bucket := range delinquencyBuckets {
+			if bucket == args[0] {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return shim.Error("逾期分档错误")
+		}
+		buckets = []string{args[0]}
+	}
+	bankName := ""
+	if len(args) > 1 {
+		bankName = args[1]
+	}
+	if err := checkBankOrRegulatorPermission(stub, bankName); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	loans := make([]Loan, 0)
+	for _, bucket := range buckets {
+		attrs := []string{bucket}
+		if bankName != "" {
+			attrs = append(attrs, bankName)
+		}
+		resultsIterator, err := stub.GetStateByPartialCompositeKey("delinquency~bank~loan", attrs)
+		if err != nil {
+			return shim.Error("查询逾期贷款失败")
+		}
+		for resultsIterator.HasNext() {
+			kv, err := resultsIterator.Next()
+			if err != nil {
+				resultsIterator.Close()
+				return shim.Error("遍历逾期贷款失败")
+			}
+			_, keys, err := stub.SplitCompositeKey(kv.Key)
+			if err != nil || len(keys) != 3 {
+				resultsIterator.Close()
+				return shim.Error("解析key失败")
+			}
+			l, ok := getLoan(stub, keys[2])
+			if !ok {
+				resultsIterator.Close()
+				return shim.Error("查询贷款失败")
+			}
+			loans = append(loans, l)
+		}
+		resultsIterator.Close()
+	}
+
+	b, err := json.Marshal(loans)
+	if err != nil {
+		return shim.Error("序列化失败")
+	}
+	return shim.Success(b)
+}
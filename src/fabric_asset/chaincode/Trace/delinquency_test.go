@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDelinquencyBucket(t *testing.T) {
+	cases := []struct {
+		days   int
+		bucket string
+	}{
+		{-1, ""},
+		{0, ""},
+		{1, Delinquency_1_30},
+		{30, Delinquency_1_30},
+		{31, Delinquency_31_90},
+		{90, Delinquency_31_90},
+		{91, Delinquency_Over90},
+		{365, Delinquency_Over90},
+	}
+	for _, c := range cases {
+		if bucket := delinquencyBucket(c.days); bucket != c.bucket {
+			t.Errorf("逾期%d天的分档为%q，应为%q", c.days, bucket, c.bucket)
+		}
+	}
+}
+
+//查询分档中的贷款编号
+func delinquentLoanIDs(t *testing.T, s *testStub, bucket string) []string {
+	var loans []Loan
+	if err := json.Unmarshal(s.mustInvoke("queryDelinquent", bucket, "icbc").Payload, &loans); err != nil {
+		t.Fatal(err)
+	}
+	loanIDs := make([]string, 0, len(loans))
+	for _, l := range loans {
+		loanIDs = append(loanIDs, l.LoanID)
+	}
+	return loanIDs
+}
+
+func TestMarkOverdueBoundaries(t *testing.T) {
+	//第一期7月1日到期，当天结束前还款都算按时
+	s, _, loanID := setupAccount(t)
+
+	cases := []struct {
+		time   string
+		days   int
+		bucket string
+	}{
+		{"2018-07-01 23:59:59", 0, ""},
+		{"2018-07-02 00:00:00", 1, Delinquency_1_30},
+		{"2018-07-31 23:59:59", 30, Delinquency_1_30},
+		{"2018-08-01 00:00:00", 31, Delinquency_31_90},
+		{"2018-09-29 23:59:59", 90, Delinquency_31_90},
+		{"2018-09-30 00:00:00", 91, Delinquency_Over90},
+	}
+	for _, c := range cases {
+		s.at(c.time).mustInvoke("markOverdue", "icbc")
+		l, _ := getLoan(s, loanID)
+		if l.DaysPastDue != c.days || l.Delinquency != c.bucket {
+			t.Errorf("%s: 逾期%d天，分档%q，应为%d天，%q", c.time, l.DaysPastDue, l.Delinquency, c.days, c.bucket)
+		}
+		//索引只在当前分档中
+		for _, bucket := range delinquencyBuckets {
+			loanIDs := delinquentLoanIDs(t, s, bucket)
+			if bucket == c.bucket && (len(loanIDs) != 1 || loanIDs[0] != loanID) {
+				t.Errorf("%s: %s分档中应有该贷款：%v", c.time, bucket, loanIDs)
+			} else if bucket != c.bucket && len(loanIDs) != 0 {
+				t.Errorf("%s: %s分档中不应有贷款：%v", c.time, bucket, loanIDs)
+			}
+		}
+	}
+}
+
+func TestRepaymentClearsDelinquency(t *testing.T) {
+	s, accountKey, loanID := setupAccount(t)
+
+	s.at("2018-07-15 10:00:00")
+	s.as(testRegulatorMSP, "admin").mustInvoke("markOverdue")
+	s.as("ICBCMSP", "teller")
+	if loanIDs := delinquentLoanIDs(t, s, Delinquency_1_30); len(loanIDs) != 1 {
+		t.Fatalf("第一期应逾期：%v", loanIDs)
+	}
+
+	//部分还款仍然逾期
+	s.mustInvoke("repayment", accountKey, "icbc", "1000")
+	if l, _ := getLoan(s, loanID); l.Delinquency != Delinquency_1_30 || l.DaysPastDue != 14 {
+		t.Errorf("部分还款后仍应逾期：%d %q", l.DaysPastDue, l.Delinquency)
+	}
+	//还清逾期的一期后恢复正常，不用等下一次逾期检查
+	s.mustInvoke("repayment", accountKey, "icbc", "120")
+	l, _ := getLoan(s, loanID)
+	if l.Delinquency != "" || l.DaysPastDue != 0 || l.Schedule[0].Status != Installment_Status_Paid || l.Schedule[1].Status != Installment_Status_Unpaid {
+		t.Errorf("还清后应恢复正常：%d %q %+v", l.DaysPastDue, l.Delinquency, l.Schedule[:2])
+	}
+	for _, bucket := range delinquencyBuckets {
+		if loanIDs := delinquentLoanIDs(t, s, bucket); len(loanIDs) != 0 {
+			t.Errorf("%s分档中不应有贷款：%v", bucket, loanIDs)
+		}
+	}
+
+	//其他银行不能检查该银行的贷款
+	s.as("CCBMSP", "teller")
+	expectRefused(t, "markOverdue", s.invoke("markOverdue", "icbc"))
+	expectRefused(t, "markOverdue", s.invoke("markOverdue"))
+}
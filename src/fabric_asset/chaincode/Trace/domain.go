@@ -1,8 +1,9 @@
 package main
 
-//银行、账户、定义交易历史
+//银行、账户、贷款、定义交易历史
 
 //定义银行
+//账户中记录的是产生该版本账户的贷款或还款
 type Bank struct {
 	//名字
 	BankName string `json:"BankName"`
@@ -18,6 +19,22 @@ type Bank struct {
 
 //定义账户
 type Account struct {
+	//账户key，身份证号加盐后的哈希
+	AccountKey string `json:"AccountKey"`
+	//加密后的个人信息，base64编码
+	PII string `json:"PII"`
+	//本次交易的贷款或还款记录，申请贷款时为空
+	Bank Bank `json:"Bank"`
+	//往来银行
+	Banks []string `json:"Banks"`
+	//贷款编号，按放款先后排列
+	Loans []string `json:"Loans"`
+	//交易历史
+	Historys []HistoryItem
+}
+
+//个人信息，加密后保存在账户中
+type AccountPII struct {
 	//身份证号
 	CardNo string `json:"CardNo"`
 	//用户名
@@ -26,16 +43,268 @@ type Account struct {
 	Gender string `json:"Gender"`
 	//电话
 	Mobile string `json:"Mobile"`
-	//银行
-	Bank Bank `json:"Bank"`
-	//交易历史
-	Historys []HistoryItem
 }
 
 //交易历史
 type HistoryItem struct {
 	//交易id
 	TxID string
+	//交易时间
+	Timestamp string
+	//是否为删除操作
+	IsDelete bool
 	//账户
 	Account Account
 }
+
+//银行登记，银行名字对应的MSP
+type BankRegistry struct {
+	//银行名字
+	BankName string `json:"BankName"`
+	//银行所在组织的MSP ID
+	MSPID string `json:"MSPID"`
+}
+
+//客户授权
+type Consent struct {
+	//账户key，身份证号加盐后的哈希
+	AccountKey string `json:"AccountKey"`
+	//被授权的银行
+	BankName string `json:"BankName"`
+	//授权范围：history、report、all
+	Scope string `json:"Scope"`
+	//到期时间
+	ExpireTime string `json:"ExpireTime"`
+	//授权人身份
+	GrantedBy string `json:"GrantedBy"`
+	//是否已撤销
+	Revoked bool `json:"Revoked"`
+	//授权交易id
+	TxID string `json:"TxID"`
+	//授权时间
+	Time string `json:"Time"`
+}
+
+//定义贷款
+type Loan struct {
+	//数据类型，固定为loan，用于CouchDB富查询
+	DocType string `json:"DocType"`
+	//贷款编号，取放款时的交易id
+	LoanID string `json:"LoanID"`
+	//账户key，身份证号加盐后的哈希
+	AccountKey string `json:"AccountKey"`
+	//银行名字
+	BankName string `json:"BankName"`
+	//贷款金额
+	Amount int `json:"Amount"`
+	//年利率，单位为万分之一
+	Rate int `json:"Rate"`
+	//期数，每月一期
+	Term int `json:"Term"`
+	//1.等额本金 2.等额本息
+	Method int `json:"Method"`
+	//1.已申请 2.审核中 3.已批准 4.已拒绝 5.已放款 6.已重组 7.已核销
+	Status int `json:"Status"`
+	//未还金额，含利息
+	Balance int `json:"Balance"`
+	//起始时间
+	StartTime string `json:"StartTime"`
+	//结束时间，即最后一期的应还日期
+	EndTime string `json:"EndTime"`
+	//还款计划
+	Schedule []Installment `json:"Schedule"`
+	//最早一期逾期未还的天数
+	DaysPastDue int `json:"DaysPastDue"`
+	//逾期分档：1-30、31-90、90+，未逾期为空
+	Delinquency string `json:"Delinquency"`
+	//还款记录
+	Repayments []RepaymentRecord `json:"Repayments"`
+	//审批流程记录
+	Steps []LoanStep `json:"Steps"`
+	//抵押物编号
+	Collaterals []string `json:"Collaterals"`
+	//重组前的原贷款编号
+	RestructuredFrom string `json:"RestructuredFrom"`
+	//重组后的新贷款编号
+	RestructuredTo string `json:"RestructuredTo"`
+	//核销金额
+	WrittenOff int `json:"WrittenOff"`
+}
+
+//抵押物
+type Collateral struct {
+	//抵押物编号
+	CollateralID string `json:"CollateralID"`
+	//担保的贷款编号
+	LoanID string `json:"LoanID"`
+	//类型，如房产、车辆
+	Type string `json:"Type"`
+	//评估价值
+	AppraisedValue int `json:"AppraisedValue"`
+	//证明文件的sha256
+	DocHash string `json:"DocHash"`
+	//1.已抵押 2.已解除
+	Status int `json:"Status"`
+	//抵押的交易id和时间
+	PledgeTxID string `json:"PledgeTxID"`
+	PledgeTime string `json:"PledgeTime"`
+	//解除的交易id和时间
+	ReleaseTxID string `json:"ReleaseTxID"`
+	ReleaseTime string `json:"ReleaseTime"`
+}
+
+//审批流程中的一步
+type LoanStep struct {
+	//变更后的状态
+	Status int `json:"Status"`
+	//操作人，MSP ID和证书名
+	Operator string `json:"Operator"`
+	//原因
+	Reason string `json:"Reason"`
+	//交易id
+	TxID string `json:"TxID"`
+	//时间
+	Time string `json:"Time"`
+}
+
+//还款计划中的一期
+type Installment struct {
+	//第几期
+	Period int `json:"Period"`
+	//应还日期
+	DueDate string `json:"DueDate"`
+	//应还本金
+	Principal int `json:"Principal"`
+	//应还利息
+	Interest int `json:"Interest"`
+	//应还金额
+	Amount int `json:"Amount"`
+	//已还金额
+	Paid int `json:"Paid"`
+	//1.未还 2.已还 3.部分还款 4.逾期
+	Status int `json:"Status"`
+}
+
+//还款记录
+type RepaymentRecord struct {
+	//还款交易id
+	TxID string `json:"TxID"`
+	//还款时间
+	Time string `json:"Time"`
+	//本笔贷款分到的还款金额
+	Amount int `json:"Amount"`
+	//冲抵的各期是否都在应还日期之前
+	OnTime bool `json:"OnTime"`
+}
+
+//信用报告
+type CreditReport struct {
+	//账户key，身份证号加盐后的哈希
+	AccountKey string `json:"AccountKey"`
+	//生成报告的交易id
+	TxID string `json:"TxID"`
+	//生成报告的时间
+	Time string `json:"Time"`
+	//未还总额
+	TotalOutstanding int `json:"TotalOutstanding"`
+	//核销总额
+	TotalWrittenOff int `json:"TotalWrittenOff"`
+	//各银行的未还情况
+	Banks []BankExposure `json:"Banks"`
+	//还款历史
+	Repayments []RepaymentItem `json:"Repayments"`
+	//还款次数
+	RepaymentCount int `json:"RepaymentCount"`
+	//按时还款次数
+	OnTimeCount int `json:"OnTimeCount"`
+	//按时还款比例
+	OnTimeRatio float64 `json:"OnTimeRatio"`
+}
+
+//在某家银行的未还情况
+type BankExposure struct {
+	//银行名字
+	BankName string `json:"BankName"`
+	//未还金额
+	Outstanding int `json:"Outstanding"`
+	//未还清的贷款编号，即放款交易id
+	LoanTxIDs []string `json:"LoanTxIDs"`
+	//这些贷款的还款交易id
+	RepaymentTxIDs []string `json:"RepaymentTxIDs"`
+	//核销金额
+	WrittenOff int `json:"WrittenOff"`
+	//核销的贷款编号
+	WrittenOffLoanIDs []string `json:"WrittenOffLoanIDs"`
+	//已重组的原贷款编号
+	RestructuredLoanIDs []string `json:"RestructuredLoanIDs"`
+}
+
+//银行贷款组合
+type BankPortfolio struct {
+	//银行名字
+	BankName string `json:"BankName"`
+	//统计区间，按交易时间，包含开始不包含结束
+	PeriodStart string `json:"PeriodStart"`
+	PeriodEnd   string `json:"PeriodEnd"`
+	//未还清的贷款笔数
+	ActiveLoans int `json:"ActiveLoans"`
+	//未还总额
+	TotalOutstanding int `json:"TotalOutstanding"`
+	//区间内的还款总额
+	RepaidInPeriod int `json:"RepaidInPeriod"`
+	//区间内的还款交易id
+	RepaymentTxIDs []string `json:"RepaymentTxIDs"`
+	//逾期贷款笔数
+	DelinquentLoans int `json:"DelinquentLoans"`
+	//逾期贷款的未还总额
+	DelinquentOutstanding int `json:"DelinquentOutstanding"`
+	//各逾期分档的未还总额
+	DelinquentByBucket map[string]int `json:"DelinquentByBucket"`
+	//核销贷款笔数
+	WrittenOffLoans int `json:"WrittenOffLoans"`
+	//核销总额
+	TotalWrittenOff int `json:"TotalWrittenOff"`
+	//区间内的核销金额
+	WrittenOffInPeriod int `json:"WrittenOffInPeriod"`
+	//区间内重组的贷款笔数
+	RestructuredInPeriod int `json:"RestructuredInPeriod"`
+}
+
+//信用报告中的还款记录
+type RepaymentItem struct {
+	//银行名字
+	BankName string `json:"BankName"`
+	//贷款编号
+	LoanID string `json:"LoanID"`
+	RepaymentRecord
+}
+
+//贷款查询条件
+type LoanSearch struct {
+	//银行名字
+	BankName string `json:"BankName"`
+	//1.按放款查询 2.按还款查询
+	Flag int `json:"Flag"`
+	//金额范围，为0时不限；按还款查询时为单笔还款金额
+	MinAmount int `json:"MinAmount"`
+	MaxAmount int `json:"MaxAmount"`
+	//日期范围，格式2006-01-02，为空时不限；按放款查询时为起始时间，按还款查询时为还款时间
+	StartDate string `json:"StartDate"`
+	EndDate   string `json:"EndDate"`
+	//每页条数
+	PageSize int `json:"PageSize"`
+	//页码，从0开始
+	Page int `json:"Page"`
+}
+
+//贷款查询结果
+type LoanSearchResult struct {
+	//当前页的贷款
+	Records []Loan `json:"Records"`
+	//页码
+	Page int `json:"Page"`
+	//每页条数
+	PageSize int `json:"PageSize"`
+	//是否还有下一页
+	HasMore bool `json:"HasMore"`
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"sort"
+	"time"
+)
+
+//测试数据
+//只有以dev实例化的链码才能由监管机构加载和清除，加载时记录写入的所有key，清除时按记录删除
+//加载时不能覆盖不是测试数据写入的key
+
+//测试数据集
+type Fixtures struct {
+	//登记的银行
+	Banks []BankRegistry `json:"Banks"`
+	//客户身份绑定
+	Customers []FixtureCustomer `json:"Customers"`
+	//已放款的贷款
+	Loans []FixtureLoan `json:"Loans"`
+}
+
+//测试客户身份
+type FixtureCustomer struct {
+	CardNo   string `json:"CardNo"`
+	Salt     string `json:"Salt"`
+	Identity string `json:"Identity"`
+}
+
+//测试贷款，按起始时间生成还款计划
+type FixtureLoan struct {
+	CardNo     string             `json:"CardNo"`
+	Salt       string             `json:"Salt"`
+	BankName   string             `json:"BankName"`
+	Amount     int                `json:"Amount"`
+	Rate       int                `json:"Rate"`
+	Term       int                `json:"Term"`
+	Method     int                `json:"Method"`
+	StartTime  string             `json:"StartTime"`
+	Repayments []FixtureRepayment `json:"Repayments"`
+}
+
+//测试还款
+type FixtureRepayment struct {
+	Amount int    `json:"Amount"`
+	Time   string `json:"Time"`
+}
+
+//默认测试数据
+//身份证号1234和12344，盐为test，均为十年期贷款，1234在abc的贷款已经还了1000
+//abc和icbc分别登记为网络中的Org0MSP和Org1MSP
+func defaultFixtures() Fixtures {
+	return Fixtures{
+		Banks: []BankRegistry{
+			{BankName: "abc", MSPID: "Org0MSP"},
+			{BankName: "icbc", MSPID: "Org1MSP"},
+		},
+		Customers: make([]FixtureCustomer, 0),
+		Loans: []FixtureLoan{
+			{
+				CardNo:    "1234",
+				Salt:      "test",
+				BankName:  "abc",
+				Amount:    5000,
+				Rate:      435,
+				Term:      120,
+				Method:    Loan_Method_EqualInstallment,
+				StartTime: "2010-02-01",
+				Repayments: []FixtureRepayment{
+					{Amount: 1000, Time: "2010-03-01 00:00:00"},
+				},
+			},
+			{
+				CardNo:     "12344",
+				Salt:       "test",
+				BankName:   "icbc",
+				Amount:     6000,
+				Rate:       490,
+				Term:       120,
+				Method:     Loan_Method_EqualPrincipal,
+				StartTime:  "2010-01-01",
+				Repayments: make([]FixtureRepayment, 0),
+			},
+		},
+	}
+}
+
+//开发模式的key
+func constructDevModeKey(stub shim.ChaincodeStubInterface) (string, error) {
+	return stub.CreateCompositeKey("config", []string{"dev"})
+}
+
+//保存是否为开发模式
+func putDevMode(stub shim.ChaincodeStubInterface, devMode bool) error {
+	key, err := constructDevModeKey(stub)
+	if err != nil {
+		return fmt.Errorf("创建key失败 %s", err)
+	}
+	if !devMode {
+		if err := stub.DelState(key); err != nil {
+			return fmt.Errorf("保存开发模式失败 %s", err)
+		}
+		return nil
+	}
+	if err := stub.PutState(key, []byte("true")); err != nil {
+		return fmt.Errorf("保存开发模式失败 %s", err)
+	}
+	return nil
+}
+
+//校验链码是否以开发模式实例化
+func checkDevMode(stub shim.ChaincodeStubInterface) error {
+	key, err := constructDevModeKey(stub)
+	if err != nil {
+		return fmt.Errorf("创建key失败 %s", err)
+	}
+	b, err := stub.GetState(key)
+	if err != nil {
+		return fmt.Errorf("查询开发模式失败")
+	}
+	if string(b) != "true" {
+		return fmt.Errorf("链码不是开发模式，不能操作测试数据")
+	}
+	return nil
+}
+
+//测试数据写入的key的记录
+func constructFixtureKeysKey(stub shim.ChaincodeStubInterface) (string, error) {
+	return stub.CreateCompositeKey("config", []string{"fixtures"})
+}
+
+//查询测试数据写入的key
+func getFixtureKeys(stub shim.ChaincodeStubInterface) ([]string, error) {
+	key, err := constructFixtureKeysKey(stub)
+	if err != nil {
+		return nil, fmt.Errorf("创建key失败 %s", err)
+	}
+	b, err := stub.GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("查询测试数据记录失败")
+	}
+	keys := make([]string, 0)
+	if b == nil {
+		return keys, nil
+	}
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, fmt.Errorf("反序列化测试数据记录失败")
+	}
+	return keys, nil
+}
+
+//记录写入的key的stub，加载测试数据时使用
+//keys中为之前加载的和本次写入的key，其他已有的key不能覆盖
+type fixtureStub struct {
+	shim.ChaincodeStubInterface
+	keys map[string]bool
+}
+
+func (s *fixtureStub) PutState(key string, value []byte) error {
+	if !s.keys[key] {
+		b, err := s.ChaincodeStubInterface.GetState(key)
+		if err != nil {
+			return fmt.Errorf("查询已有数据失败")
+		}
+		if b != nil {
+			return fmt.Errorf("测试数据不能覆盖已有数据")
+		}
+	}
+	s.keys[key] = true
+	return s.ChaincodeStubInterface.PutState(key, value)
+}
+
+//加载测试数据
+//-c '{"Args":["initTest","测试数据json(可选)"]}'
+//不传时加载默认测试数据，写入的key追加到记录中，由监管机构提交
+func initTest(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) > 1 {
+		return shim.Error("参数个数错误")
+	}
+	if err := checkDevMode(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkRegulatorPermission(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	fixtures := defaultFixtures()
+	if len(args) == 1 {
+		fixtures = Fixtures{}
+		if err := json.Unmarshal([]byte(args[0]), &fixtures); err != nil {
+			return shim.Error("测试数据解析失败")
+		}
+	}
+
+	//之前加载的测试数据可以覆盖，记录追加
+	keys, err := getFixtureKeys(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	fs := &fixtureStub{ChaincodeStubInterface: stub, keys: make(map[string]bool)}
+	for _, key := range keys {
+		fs.keys[key] = true
+	}
+	if err := loadFixtures(fs, fixtures); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	keys = make([]string, 0, len(fs.keys))
+	for key := range fs.keys {
+		keys = append(keys, key)
+	}
+	//map的遍历顺序不固定，排序后各背书节点的结果才一致
+	sort.Strings(keys)
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return shim.Error("序列化测试数据记录失败")
+	}
+	recordKey, err := constructFixtureKeysKey(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("创建key失败 %s", err))
+	}
+	if err := stub.PutState(recordKey, b); err != nil {
+		return shim.Error(fmt.Sprintf("保存测试数据记录失败 %s", err))
+	}
+	return shim.Success([]byte(fmt.Sprintf("加载测试数据成功，共%d个key", len(keys))))
+}
+
+//写入测试数据，不校验提交者
+func loadFixtures(stub shim.ChaincodeStubInterface, fixtures Fixtures) error {
+	for _, registry := range fixtures.Banks {
+		if registry.BankName == "" || registry.MSPID == "" {
+			return fmt.Errorf("测试银行的名字和MSP ID不能为空")
+		}
+		b, err := json.Marshal(registry)
+		if err != nil {
+			return fmt.Errorf("序列化失败")
+		}
+		key, err := constructBankKey(stub, registry.BankName)
+		if err != nil {
+			return fmt.Errorf("创建key失败 %s", err)
+		}
+		if err := stub.PutState(key, b); err != nil {
+			return fmt.Errorf("保存测试银行失败 %s", err)
+		}
+	}
+
+	for _, customer := range fixtures.Customers {
+		key, err := constructCustomerKey(stub, hashAccountKey(customer.CardNo, customer.Salt))
+		if err != nil {
+			return fmt.Errorf("创建key失败 %s", err)
+		}
+		if err := stub.PutState(key, []byte(customer.Identity)); err != nil {
+			return fmt.Errorf("保存测试客户失败 %s", err)
+		}
+	}
+
+	//同一交易中读不到自己写入的数据，同一账户的多笔贷款在内存中累积后再保存
+	accounts := make(map[string]*Account)
+	accountKeys := make([]string, 0)
+	for i, fl := range fixtures.Loans {
+		start, err := time.Parse(Date_Layout, fl.StartTime)
+		if err != nil {
+			return fmt.Errorf("第%d笔测试贷款的起始时间格式错误", i+1)
+		}
+		schedule, err := buildSchedule(fl.Amount, fl.Rate, fl.Term, fl.Method, start)
+		if err != nil {
+			return fmt.Errorf("第%d笔测试贷款：%s", i+1, err)
+		}
+		accountKey := hashAccountKey(fl.CardNo, fl.Salt)
+		account, ok := accounts[accountKey]
+		if !ok {
+			acc, _, err := getAccount(stub, accountKey)
+			if err != nil {
+				return err
+			}
+			account = &acc
+			accounts[accountKey] = account
+			accountKeys = append(accountKeys, accountKey)
+		}
+
+		l := Loan{
+			DocType:     Loan_DocType,
+			LoanID:      fmt.Sprintf("%s-%d", stub.GetTxID(), i),
+			AccountKey:  account.AccountKey,
+			BankName:    fl.BankName,
+			Amount:      fl.Amount,
+			Rate:        fl.Rate,
+			Term:        fl.Term,
+			Method:      fl.Method,
+			Status:      Loan_Status_Disbursed,
+			Balance:     sumSchedule(schedule),
+			StartTime:   fl.StartTime,
+			EndTime:     schedule[len(schedule)-1].DueDate,
+			Schedule:    schedule,
+			Repayments:  make([]RepaymentRecord, 0),
+			Steps:       make([]LoanStep, 0),
+			Collaterals: make([]string, 0),
+		}
+		account.Bank = Bank{
+			BankName:  l.BankName,
+			Amount:    l.Amount,
+			Flag:      Bank_Flag_Loan,
+			StartTime: l.StartTime,
+			EndTime:   l.EndTime,
+		}
+		for j, fr := range fl.Repayments {
+			t, err := time.Parse(Time_Layout, fr.Time)
+			if err != nil {
+				return fmt.Errorf("第%d笔测试贷款的还款时间格式错误", i+1)
+			}
+			allocateRepayment(&l, fr.Amount, fmt.Sprintf("%s-%d", l.LoanID, j), t)
+			account.Bank = Bank{
+				BankName:  l.BankName,
+				Amount:    fr.Amount,
+				Flag:      Bank_Flag_Repayment,
+				StartTime: t.Format(Date_Layout),
+			}
+		}
+
+		if err := addBank(stub, account, l.BankName); err != nil {
+			return err
+		}
+		if err := addLoan(stub, account, l); err != nil {
+			return err
+		}
+	}
+	for _, accountKey := range accountKeys {
+		if !putAccount(stub, *accounts[accountKey]) {
+			return fmt.Errorf("保存测试账户失败")
+		}
+	}
+	return nil
+}
+
+//清除测试数据
+//-c '{"Args":["resetFixtures"]}'
+//删除加载测试数据时写入的所有key，以及这些贷款的逾期索引，由监管机构提交
+func resetFixtures(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 0 {
+		return shim.Error("参数个数错误")
+	}
+	if err := checkDevMode(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkRegulatorPermission(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+	keys, err := getFixtureKeys(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for _, key := range keys {
+		//贷款加载后可能被逾期检查加入索引；账户key不是组合key，不能拆分
+		if !isAccountKey(key) {
+			objectType, attrs, err := stub.SplitCompositeKey(key)
+			if err == nil && objectType == "loan" && len(attrs) == 1 {
+				if l, ok := getLoan(stub, attrs[0]); ok && l.Delinquency != "" {
+					indexKey, err := stub.CreateCompositeKey("delinquency~bank~loan", []string{l.Delinquency, l.BankName, l.LoanID})
+					if err != nil {
+						return shim.Error(fmt.Sprintf("创建key失败 %s", err))
+					}
+					if err := stub.DelState(indexKey); err != nil {
+						return shim.Error(fmt.Sprintf("删除逾期索引失败 %s", err))
+					}
+				}
+			}
+		}
+		if err := stub.DelState(key); err != nil {
+			return shim.Error(fmt.Sprintf("删除测试数据失败 %s", err))
+		}
+	}
+
+	recordKey, err := constructFixtureKeysKey(stub)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("创建key失败 %s", err))
+	}
+	if err := stub.DelState(recordKey); err != nil {
+		return shim.Error(fmt.Sprintf("删除测试数据记录失败 %s", err))
+	}
+	return shim.Success([]byte(fmt.Sprintf("清除测试数据成功，共%d个key", len(keys))))
+}
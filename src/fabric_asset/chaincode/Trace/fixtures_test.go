@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"testing"
+)
+
+//以开发模式初始化，监管机构为RegulatorMSP
+func newDevStub(t *testing.T) *testStub {
+	s := newTestStub(t)
+	if res := s.as(testRegulatorMSP, "admin").init(testRegulatorMSP, "dev"); res.Status != shim.OK {
+		t.Fatalf("初始化失败：%s", res.Message)
+	}
+	return s
+}
+
+func TestInitTestRequiresDevModeAndRegulator(t *testing.T) {
+	s := newTestStub(t)
+	s.as(testRegulatorMSP, "admin").init(testRegulatorMSP)
+	expectRefused(t, "initTest", s.invoke("initTest"))
+
+	s = newDevStub(t)
+	s.as("Org1MSP", "teller")
+	expectRefused(t, "initTest", s.invoke("initTest"))
+	expectRefused(t, "resetFixtures", s.invoke("resetFixtures"))
+}
+
+func TestDefaultFixturesUsable(t *testing.T) {
+	s := newDevStub(t)
+	s.mustInvoke("initTest")
+	//重复加载只覆盖测试数据
+	s.mustInvoke("initTest")
+
+	//测试贷款的银行已登记，可以直接还款
+	s.as("Org1MSP", "teller")
+	s.mustInvoke("repayment", hashAccountKey("12344", "test"), "icbc", "100")
+	s.as("Org0MSP", "teller")
+	s.mustInvoke("repayment", hashAccountKey("1234", "test"), "abc", "100")
+	expectRefused(t, "repayment", s.invoke("repayment", hashAccountKey("12344", "test"), "icbc", "100"))
+
+	//测试贷款早已逾期，清除时一并删除逾期索引
+	s.as(testRegulatorMSP, "admin").mustInvoke("markOverdue")
+	s.mustInvoke("resetFixtures")
+	if res := s.mustInvoke("queryDelinquent"); string(res.Payload) != "[]" {
+		t.Errorf("清除后不应有逾期贷款：%s", res.Payload)
+	}
+	if _, ok := getBankRegistry(s, "icbc"); ok {
+		t.Error("清除后测试银行应删除")
+	}
+	if _, exist, _ := getAccount(s, hashAccountKey("12344", "test")); exist {
+		t.Error("清除后测试账户应删除")
+	}
+}
+
+func TestFixturesDoNotOverwriteData(t *testing.T) {
+	s := newDevStub(t)
+	s.mustInvoke("registerBank", "icbc", "ICBCMSP")
+	//已登记的银行不能被测试数据覆盖
+	expectRefused(t, "initTest", s.invoke("initTest"))
+	if registry, _ := getBankRegistry(s, "icbc"); registry.MSPID != "ICBCMSP" {
+		t.Errorf("银行登记被覆盖：%+v", registry)
+	}
+
+	//已有账户不能被测试数据覆盖
+	s.as("ICBCMSP", "teller").withTransient(map[string][]byte{"CardNo": []byte("12344"), "salt": []byte("test")})
+	s.mustInvoke("applyLoan", "", "icbc", "1000", "1200", "12", "1", "消费贷款")
+	s.withTransient(nil)
+	fixtures := `{"Loans":[{"CardNo":"12344","Salt":"test","BankName":"icbc","Amount":6000,"Rate":490,"Term":120,"Method":1,"StartTime":"2010-01-01"}]}`
+	s.as(testRegulatorMSP, "admin")
+	expectRefused(t, "initTest", s.invoke("initTest", fixtures))
+	if account, _, _ := getAccount(s, hashAccountKey("12344", "test")); len(account.Loans) != 1 {
+		t.Errorf("账户被测试数据覆盖：%+v", account)
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
@@ -11,94 +10,168 @@ type TraceChaincode struct {
 }
 
 //初始化方法
+//-c '{"Args":["init","监管机构MSP(可选)","dev(可选)"]}'
+//监管机构负责登记银行，不传时为实例化链码的组织
+//传dev时为开发模式，才能加载测试数据
 func (t *TraceChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
-	//初始化测试数据
-	initTest(stub)
+	_, args := stub.GetFunctionAndParameters()
+	if len(args) > 2 {
+		return shim.Error("参数个数错误")
+	}
+	var regulator string
+	if len(args) > 0 && args[0] != "" {
+		regulator = args[0]
+	} else {
+		mspID, err := getCreatorMSP(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		regulator = mspID
+	}
+	if err := putRegulator(stub, regulator); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//开发模式，升级链码时也会重新设置
+	devMode := false
+	if len(args) == 2 {
+		if args[1] != "dev" {
+			return shim.Error("参数错误")
+		}
+		devMode = true
+	}
+	if err := putDevMode(stub, devMode); err != nil {
+		return shim.Error(err.Error())
+	}
 	return shim.Success(nil)
 }
 
 //链码入口
-//loan:贷款
+//applyLoan:贷款申请
+//reviewLoan：审核贷款
+//approveLoan：批准贷款
+//rejectLoan：拒绝贷款
+//disburseLoan：放款
 //repayment：还款
-//initTest：测试初始化=
+//queryAccountHistory：账户历史查询
+//queryAccountBanks：账户往来银行查询
+//queryBankAccounts：银行客户查询
+//queryLoans：贷款查询
+//creditReport：信用报告
+//registerBank：登记银行
+//queryBank：银行登记查询
+//markOverdue：逾期检查
+//queryDelinquent：逾期贷款查询
+//bindCustomer：绑定客户身份
+//grantConsent：授权银行查询
+//revokeConsent：撤销授权
+//queryConsents：授权查询
+//setAccountPII：保存个人信息
+//queryAccountPII：个人信息查询
+//searchLoans：按条件查询贷款，需要CouchDB
+//bankPortfolio：银行贷款组合
+//attachCollateral：登记抵押物
+//queryCollateral：抵押物查询
+//restructureLoan：贷款重组
+//writeOffLoan：贷款核销
+//initTest：加载测试数据，仅开发模式，由监管机构提交
+//resetFixtures：清除测试数据，仅开发模式，由监管机构提交
 func (t *TraceChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	//得到方法名和参数
 	fun, args := stub.GetFunctionAndParameters()
 	//进行判断
-	if fun == "loan" {
-		//贷款
-		return loan(stub, args)
+	if fun == "applyLoan" {
+		//贷款申请
+		return applyLoan(stub, args)
+	} else if fun == "reviewLoan" {
+		//审核贷款
+		return reviewLoan(stub, args)
+	} else if fun == "approveLoan" {
+		//批准贷款
+		return approveLoan(stub, args)
+	} else if fun == "rejectLoan" {
+		//拒绝贷款
+		return rejectLoan(stub, args)
+	} else if fun == "disburseLoan" {
+		//放款
+		return disburseLoan(stub, args)
 	} else if fun == "repayment" {
 		//还款
 		return repayment(stub, args)
+	} else if fun == "queryAccountHistory" {
+		//账户历史查询
+		return queryAccountHistory(stub, args)
+	} else if fun == "queryAccountBanks" {
+		//账户往来银行查询
+		return queryAccountBanks(stub, args)
+	} else if fun == "queryBankAccounts" {
+		//银行客户查询
+		return queryBankAccounts(stub, args)
+	} else if fun == "queryLoans" {
+		//贷款查询
+		return queryLoans(stub, args)
+	} else if fun == "creditReport" {
+		//信用报告
+		return creditReport(stub, args)
+	} else if fun == "registerBank" {
+		//登记银行
+		return registerBank(stub, args)
+	} else if fun == "queryBank" {
+		//银行登记查询
+		return queryBank(stub, args)
+	} else if fun == "markOverdue" {
+		//逾期检查
+		return markOverdue(stub, args)
+	} else if fun == "queryDelinquent" {
+		//逾期贷款查询
+		return queryDelinquent(stub, args)
+	} else if fun == "bindCustomer" {
+		//绑定客户身份
+		return bindCustomer(stub, args)
+	} else if fun == "grantConsent" {
+		//授权银行查询
+		return grantConsent(stub, args)
+	} else if fun == "revokeConsent" {
+		//撤销授权
+		return revokeConsent(stub, args)
+	} else if fun == "queryConsents" {
+		//授权查询
+		return queryConsents(stub, args)
+	} else if fun == "setAccountPII" {
+		//保存个人信息
+		return setAccountPII(stub, args)
+	} else if fun == "queryAccountPII" {
+		//个人信息查询
+		return queryAccountPII(stub, args)
+	} else if fun == "searchLoans" {
+		//按条件查询贷款
+		return searchLoans(stub, args)
+	} else if fun == "bankPortfolio" {
+		//银行贷款组合
+		return bankPortfolio(stub, args)
+	} else if fun == "attachCollateral" {
+		//登记抵押物
+		return attachCollateral(stub, args)
+	} else if fun == "queryCollateral" {
+		//抵押物查询
+		return queryCollateral(stub, args)
+	} else if fun == "restructureLoan" {
+		//贷款重组
+		return restructureLoan(stub, args)
+	} else if fun == "writeOffLoan" {
+		//贷款核销
+		return writeOffLoan(stub, args)
 	} else if fun == "initTest" {
-		return initTest(stub)
+		//加载测试数据
+		return initTest(stub, args)
+	} else if fun == "resetFixtures" {
+		//清除测试数据
+		return resetFixtures(stub, args)
 	} else {
 		return shim.Error("方法名错误")
 	}
 }
 
-//测试方法
-func initTest(stub shim.ChaincodeStubInterface) pb.Response {
-	bank := Bank{
-		BankName: "icbc",
-		Amount:   6000,
-		//贷款
-		Flag:      1,
-		StartTime: "2010-01-01",
-		EndTime:   "2020-01-01",
-	}
-
-	bank1 := Bank{
-		BankName: "abc",
-		Amount:   1000,
-		//还款
-		Flag:      2,
-		StartTime: "2010-02-01",
-		EndTime:   "2020-02-01",
-	}
-
-	account := Account{
-		CardNo:   "1234",
-		Aname:    "jack",
-		Gender:   "男",
-		Mobile:   "15900000",
-		Bank:     bank1,
-		Historys: nil,
-	}
-
-	account1 := Account{
-		CardNo:   "12344",
-		Aname:    "jack2",
-		Gender:   "男",
-		Mobile:   "15900000000",
-		Bank:     bank,
-		Historys: nil,
-	}
-
-	//对象序列化，存储
-	accBytes, err := json.Marshal(account)
-	if err != nil {
-		return shim.Error("序列化账户失败")
-	}
-	accBytes1, err := json.Marshal(account1)
-	if err != nil {
-		return shim.Error("序列化账户1失败")
-	}
-
-	//保存
-	err = stub.PutState(account.CardNo, accBytes)
-	if err != nil {
-		return shim.Error("保存账户失败")
-	}
-	err = stub.PutState(account1.CardNo, accBytes1)
-	if err != nil {
-		return shim.Error("保存账户1失败")
-	}
-
-	return shim.Success(nil)
-}
-
 func main() {
 	err := shim.Start(new(TraceChaincode))
 	if err != nil {
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	mspprotos "github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"math/big"
+	"strconv"
+	"testing"
+	"time"
+)
+
+//测试用的stub
+//MockStub取不到提交者身份、交易时间和transient，由testStub补上，再直接调用链码
+type testStub struct {
+	*shim.MockStub
+	t         *testing.T
+	cc        *TraceChaincode
+	args      [][]byte
+	creator   []byte
+	transient map[string][]byte
+	txTime    time.Time
+	txCount   int
+}
+
+func newTestStub(t *testing.T) *testStub {
+	cc := new(TraceChaincode)
+	return &testStub{
+		MockStub: shim.NewMockStub("trace", cc),
+		t:        t,
+		cc:       cc,
+		txTime:   time.Date(2018, 6, 1, 8, 0, 0, 0, time.UTC),
+	}
+}
+
+func (s *testStub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *testStub) GetStringArgs() []string {
+	args := make([]string, 0, len(s.args))
+	for _, arg := range s.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+func (s *testStub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+func (s *testStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func (s *testStub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+func (s *testStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: s.txTime.Unix(), Nanos: int32(s.txTime.Nanosecond())}, nil
+}
+
+//设置之后交易的时间，格式同Time_Layout
+func (s *testStub) at(value string) *testStub {
+	t, err := time.Parse(Time_Layout, value)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.txTime = t
+	return s
+}
+
+//切换提交者，identity为 MSP ID/证书名
+func (s *testStub) as(mspID string, commonName string) *testStub {
+	s.creator = newCreator(s.t, mspID, commonName)
+	return s
+}
+
+//设置下一笔交易的transient，传nil清除
+func (s *testStub) withTransient(transient map[string][]byte) *testStub {
+	s.transient = transient
+	return s
+}
+
+//以当前提交者执行一笔交易
+func (s *testStub) call(init bool, args ...string) pb.Response {
+	s.txCount++
+	txID := fmt.Sprintf("tx%d", s.txCount)
+	s.args = make([][]byte, 0, len(args))
+	for _, arg := range args {
+		s.args = append(s.args, []byte(arg))
+	}
+	s.MockTransactionStart(txID)
+	defer s.MockTransactionEnd(txID)
+	if init {
+		return s.cc.Init(s)
+	}
+	return s.cc.Invoke(s)
+}
+
+func (s *testStub) init(args ...string) pb.Response {
+	return s.call(true, append([]string{"init"}, args...)...)
+}
+
+func (s *testStub) invoke(args ...string) pb.Response {
+	return s.call(false, args...)
+}
+
+//执行交易并要求成功
+func (s *testStub) mustInvoke(args ...string) pb.Response {
+	res := s.invoke(args...)
+	if res.Status != shim.OK {
+		s.t.Fatalf("%s 执行失败：%s", args[0], res.Message)
+	}
+	return res
+}
+
+//以银行身份为已有账户申请贷款并放款，返回贷款编号
+//等额本金，月利率1%，按期数生成还款计划
+func (s *testStub) openLoan(mspID string, bankName string, accountKey string, amount int, term int) string {
+	s.as(mspID, "teller")
+	loanID := string(s.mustInvoke("applyLoan", accountKey, bankName, strconv.Itoa(amount), "1200", strconv.Itoa(term), "1", "消费贷款").Payload)
+	s.mustInvoke("reviewLoan", loanID, "资料齐全")
+	s.mustInvoke("approveLoan", loanID, "同意")
+	s.mustInvoke("disburseLoan", loanID, "放款")
+	return loanID
+}
+
+//生成自签名证书，序列化为提交者身份
+func newCreator(t *testing.T, mspID string, commonName string) []byte {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creator, err := proto.Marshal(&mspprotos.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return creator
+}
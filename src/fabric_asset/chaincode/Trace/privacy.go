@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//个人信息保护
+//账本中不保存明文的身份证号、姓名和电话：
+//账户key为sha256(salt+身份证号)，个人信息用AES-GCM加密后保存
+//身份证号、salt、密钥和个人信息都通过transient传入，不会写入交易
+//transient的key：
+//CardNo：身份证号
+//salt：盐
+//piiKey：AES密钥，16、24或32字节
+//pii：个人信息json，格式同AccountPII
+
+//身份证号加盐计算账户key
+func hashAccountKey(cardNo string, salt string) string {
+	sum := sha256.Sum256([]byte(salt + cardNo))
+	return hex.EncodeToString(sum[:])
+}
+
+//取transient中的身份证号和盐，没有传入时ok为false
+func getTransientCardNo(stub shim.ChaincodeStubInterface) (cardNo string, salt string, ok bool, err error) {
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return "", "", false, fmt.Errorf("获取transient失败")
+	}
+	if len(transient["CardNo"]) == 0 || len(transient["salt"]) == 0 {
+		return "", "", false, nil
+	}
+	return string(transient["CardNo"]), string(transient["salt"]), true, nil
+}
+
+//确定账户key
+//transient中有CardNo和salt时由身份证号计算，此时参数可以为空
+//否则参数必须是64位小写十六进制的账户key，不接受明文身份证号
+func resolveAccountKey(stub shim.ChaincodeStubInterface, arg string) (string, error) {
+	cardNo, salt, ok, err := getTransientCardNo(stub)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		if !isAccountKey(arg) {
+			return "", fmt.Errorf("账户key格式错误")
+		}
+		return arg, nil
+	}
+	accountKey := hashAccountKey(cardNo, salt)
+	if arg != "" && arg != accountKey {
+		return "", fmt.Errorf("账户key与身份证号不匹配")
+	}
+	return accountKey, nil
+}
+
+//是否为hashAccountKey生成的账户key
+func isAccountKey(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+//取transient中的AES密钥
+func getPIIKey(stub shim.ChaincodeStubInterface) ([]byte, error) {
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("获取transient失败")
+	}
+	key := transient["piiKey"]
+	if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+		return nil, fmt.Errorf("transient中的piiKey长度错误")
+	}
+	return key, nil
+}
+
+//加密个人信息
+//各背书节点的加密结果必须一致，nonce由账户key和交易id计算，不使用随机数
+func encryptPII(stub shim.ChaincodeStubInterface, accountKey string, pii AccountPII) (string, error) {
+	key, err := getPIIKey(stub)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	plain, err := json.Marshal(pii)
+	if err != nil {
+		return "", fmt.Errorf("序列化个人信息失败")
+	}
+	sum := sha256.Sum256([]byte(accountKey + stub.GetTxID()))
+	nonce := sum[:gcm.NonceSize()]
+	sealed := gcm.Seal(nil, nonce, plain, []byte(accountKey))
+	return base64.StdEncoding.EncodeToString(append(nonce, sealed...)), nil
+}
+
+//解密个人信息
+func decryptPII(stub shim.ChaincodeStubInterface, account Account) (AccountPII, error) {
+	var pii AccountPII
+	if account.PII == "" {
+		return pii, fmt.Errorf("账户没有个人信息")
+	}
+	key, err := getPIIKey(stub)
+	if err != nil {
+		return pii, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return pii, err
+	}
+	data, err := base64.StdEncoding.DecodeString(account.PII)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return pii, fmt.Errorf("个人信息格式错误")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(account.AccountKey))
+	if err != nil {
+		return pii, fmt.Errorf("解密个人信息失败")
+	}
+	if err := json.Unmarshal(plain, &pii); err != nil {
+		return pii, fmt.Errorf("反序列化个人信息失败")
+	}
+	return pii, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("创建密钥失败")
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("创建密钥失败")
+	}
+	return gcm, nil
+}
+
+//保存个人信息
+//-c '{"Args":["setAccountPII","账户key","银行名字"]}' --transient '{"CardNo":"","salt":"","piiKey":"","pii":""}'
+//由与账户有往来的银行提交，个人信息中的身份证号必须与账户key一致
+func setAccountPII(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 2 {
+		return shim.Error("参数个数错误")
+	}
+	accountKey, err := resolveAccountKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkBankPermission(stub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	account, exist, err := getAccount(stub, accountKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !exist || !hasBank(account, args[1]) {
+		return shim.Error("账户在该银行没有贷款")
+	}
+
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return shim.Error("获取transient失败")
+	}
+	var pii AccountPII
+	if err := json.Unmarshal(transient["pii"], &pii); err != nil {
+		return shim.Error("transient中的个人信息解析失败")
+	}
+	if hashAccountKey(pii.CardNo, string(transient["salt"])) != accountKey {
+		return shim.Error("个人信息中的身份证号与账户key不匹配")
+	}
+	account.PII, err = encryptPII(stub, accountKey, pii)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//不是贷款或还款
+	account.Bank = Bank{}
+
+	if !putAccount(stub, account) {
+		return shim.Error("保存账户失败")
+	}
+	return shim.Success([]byte("保存个人信息成功"))
+}
+
+//查询个人信息
+//-c '{"Args":["queryAccountPII","账户key"]}' --transient '{"piiKey":""}'
+//由客户本人或得到客户授权的银行查询，解密需要提供密钥
+func queryAccountPII(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 1 {
+		return shim.Error("参数个数错误")
+	}
+	accountKey, err := resolveAccountKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := checkConsent(stub, accountKey, Consent_Scope_History); err != nil {
+		return shim.Error(err.Error())
+	}
+	account, exist, err := getAccount(stub, accountKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !exist {
+		return shim.Error("账户不存在")
+	}
+	pii, err := decryptPII(stub, account)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	b, err := json.Marshal(pii)
+	if err != nil {
+		return shim.Error("序列化失败")
+	}
+	return shim.Success(b)
+}
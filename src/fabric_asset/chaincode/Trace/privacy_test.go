@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestResolveAccountKey(t *testing.T) {
+	s := newTestStub(t)
+	accountKey := hashAccountKey(testCardNo, testSalt)
+
+	//没有transient时只接受账户key
+	for _, arg := range []string{"", testCardNo, strings.ToUpper(accountKey), accountKey[1:]} {
+		if _, err := resolveAccountKey(s, arg); err == nil {
+			t.Errorf("%q 不应作为账户key", arg)
+		}
+	}
+	if key, err := resolveAccountKey(s, accountKey); err != nil || key != accountKey {
+		t.Errorf("账户key解析错误：%s %v", key, err)
+	}
+
+	//有transient时由身份证号计算
+	s.withTransient(map[string][]byte{"CardNo": []byte(testCardNo), "salt": []byte(testSalt)})
+	if key, err := resolveAccountKey(s, ""); err != nil || key != accountKey {
+		t.Errorf("账户key计算错误：%s %v", key, err)
+	}
+	if _, err := resolveAccountKey(s, hashAccountKey(testCardNo, "other")); err == nil {
+		t.Error("账户key与身份证号不匹配时应返回错误")
+	}
+}
+
+func TestApplyLoanRequiresCardNoToOpenAccount(t *testing.T) {
+	s, accountKey := setupConsent(t)
+
+	//新账户不能只传账户key开户
+	s.as("ICBCMSP", "teller")
+	other := hashAccountKey("110101199001015678", testSalt)
+	expectRefused(t, "applyLoan", s.invoke("applyLoan", other, "icbc", "1000", "1200", "12", "1", "消费贷款"))
+
+	//已有账户可以用账户key申请
+	s.mustInvoke("applyLoan", accountKey, "icbc", "1000", "1200", "12", "1", "消费贷款")
+}
+
+func TestHashAccountKey(t *testing.T) {
+	//sha256(salt+身份证号)，各节点、各版本必须一致
+	accountKey := hashAccountKey(testCardNo, testSalt)
+	if accountKey != "0fc1a9753f98891a6e1807b05424d70b11b268a2b2b94592d486c411957b1841" {
+		t.Errorf("账户key计算结果变化：%s", accountKey)
+	}
+	if !isAccountKey(accountKey) {
+		t.Errorf("%s 应为账户key", accountKey)
+	}
+	if hashAccountKey(testCardNo, "other") == accountKey {
+		t.Error("不同的盐应得到不同的账户key")
+	}
+	if hashAccountKey("110101199001015678", testSalt) == accountKey {
+		t.Error("不同的身份证号应得到不同的账户key")
+	}
+}
+
+func TestWrongSaltOrCardNoFindsNoAccount(t *testing.T) {
+	s, accountKey := setupConsent(t)
+
+	cases := []struct {
+		name   string
+		cardNo string
+		salt   string
+	}{
+		{"盐错误", testCardNo, "other"},
+		{"身份证号错误", "110101199001015678", testSalt},
+	}
+	for _, c := range cases {
+		transient := map[string][]byte{"CardNo": []byte(c.cardNo), "salt": []byte(c.salt)}
+		//计算出的账户key与传入的不一致
+		s.as("ICBCMSP", "teller").withTransient(transient)
+		expectRefused(t, c.name, s.invoke("repayment", accountKey, "icbc", "100"))
+		//计算出的账户不存在
+		expectRefused(t, c.name, s.invoke("repayment", "", "icbc", "100"))
+		s.as(testCustomerMSP, "alice")
+		expectRefused(t, c.name, s.invoke("queryLoans", ""))
+	}
+	s.withTransient(nil)
+
+	//正确的身份证号和盐可以查到
+	s.withTransient(map[string][]byte{"CardNo": []byte(testCardNo), "salt": []byte(testSalt)})
+	s.mustInvoke("queryLoans", "")
+	s.withTransient(nil)
+}
+
+func TestAccountPIIEncrypted(t *testing.T) {
+	s, accountKey := setupConsent(t)
+	piiKey := []byte("0123456789abcdef")
+	pii := AccountPII{CardNo: testCardNo, Aname: "张三", Gender: "男", Mobile: "13800000000"}
+	b, err := json.Marshal(pii)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//个人信息中的身份证号必须与账户key一致
+	other := pii
+	other.CardNo = "110101199001015678"
+	otherBytes, err := json.Marshal(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.withTransient(map[string][]byte{"CardNo": []byte(testCardNo), "salt": []byte(testSalt), "piiKey": piiKey, "pii": otherBytes})
+	expectRefused(t, "setAccountPII", s.invoke("setAccountPII", accountKey, "icbc"))
+	//没有往来的银行不能保存
+	s.as("CCBMSP", "teller").withTransient(map[string][]byte{"CardNo": []byte(testCardNo), "salt": []byte(testSalt), "piiKey": piiKey, "pii": b})
+	expectRefused(t, "setAccountPII", s.invoke("setAccountPII", accountKey, "ccb"))
+
+	s.as("ICBCMSP", "teller")
+	s.mustInvoke("setAccountPII", accountKey, "icbc")
+	s.withTransient(nil)
+	//账本中没有明文
+	state := string(s.State[accountKey])
+	if strings.Contains(state, testCardNo) || strings.Contains(state, pii.Mobile) {
+		t.Errorf("账户中保存了明文个人信息：%s", state)
+	}
+
+	//客户本人用正确的密钥可以解密
+	s.as(testCustomerMSP, "alice").withTransient(map[string][]byte{"piiKey": piiKey})
+	var got AccountPII
+	if err := json.Unmarshal(s.mustInvoke("queryAccountPII", accountKey).Payload, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != pii {
+		t.Errorf("解密后的个人信息错误：%+v", got)
+	}
+	//密钥错误不能解密
+	s.withTransient(map[string][]byte{"piiKey": []byte("fedcba9876543210")})
+	expectRefused(t, "queryAccountPII", s.invoke("queryAccountPII", accountKey))
+	//未授权的银行有密钥也不能查询
+	s.as("CCBMSP", "teller").withTransient(map[string][]byte{"piiKey": piiKey})
+	expectRefused(t, "queryAccountPII", s.invoke("queryAccountPII", accountKey))
+	s.withTransient(nil)
+}
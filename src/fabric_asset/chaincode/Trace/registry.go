@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	mspprotos "github.com/hyperledger/fabric/protos/msp"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//银行登记
+//银行名字和组织MSP绑定，贷款、还款时校验提交者是否属于该银行
+
+//解析交易提交者的身份
+func getCreator(stub shim.ChaincodeStubInterface) (*mspprotos.SerializedIdentity, error) {
+	creator, err := stub.GetCreator()
+	if err != nil || creator == nil {
+		return nil, fmt.Errorf("获取提交者身份失败")
+	}
+	identity := &mspprotos.SerializedIdentity{}
+	if err := proto.Unmarshal(creator, identity); err != nil {
+		return nil, fmt.Errorf("解析提交者身份失败")
+	}
+	return identity, nil
+}
+
+//取交易提交者的MSP ID
+func getCreatorMSP(stub shim.ChaincodeStubInterface) (string, error) {
+	identity, err := getCreator(stub)
+	if err != nil {
+		return "", err
+	}
+	return identity.Mspid, nil
+}
+
+//交易提交者的标识，格式为 MSP ID/证书名
+func getCreatorIdentity(stub shim.ChaincodeStubInterface) (string, error) {
+	identity, err := getCreator(stub)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(identity.IdBytes)
+	if block == nil {
+		return "", fmt.Errorf("解析提交者证书失败")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("解析提交者证书失败")
+	}
+	return identity.Mspid + "/" + cert.Subject.CommonName, nil
+}
+
+//监管机构的key
+func constructRegulatorKey(stub shim.ChaincodeStubInterface) (string, error) {
+	return stub.CreateCompositeKey("config", []string{"regulator"})
+}
+
+//保存监管机构的MSP
+func putRegulator(stub shim.ChaincodeStubInterface, mspID string) error {
+	key, err := constructRegulatorKey(stub)
+	if err != nil {
+		return fmt.Errorf("创建key失败 %s", err)
+	}
+	if err := stub.PutState(key, []byte(mspID)); err != nil {
+		return fmt.Errorf("保存监管机构失败 %s", err)
+	}
+	return nil
+}
+
+//查询监管机构的MSP
+func getRegulator(stub shim.ChaincodeStubInterface) (string, error) {
+	key, err := constructRegulatorKey(stub)
+	if err != nil {
+		return "", fmt.Errorf("创建key失败 %s", err)
+	}
+	b, err := stub.GetState(key)
+	if err != nil || b == nil {
+		return "", fmt.Errorf("未设置监管机构")
+	}
+	return string(b), nil
+}
+
+//校验提交者是否属于监管机构
+func checkRegulatorPermission(stub shim.ChaincodeStubInterface) error {
+	regulator, err := getRegulator(stub)
+	if err != nil {
+		return err
+	}
+	mspID, err := getCreatorMSP(stub)
+	if err != nil {
+		return err
+	}
+	if mspID != regulator {
+		return fmt.Errorf("只有监管机构可以进行该操作")
+	}
+	return nil
+}
+
+//银行登记的key
+func constructBankKey(stub shim.ChaincodeStubInterface, bankName string) (string, error) {
+	return stub.CreateCompositeKey("bank", []string{bankName})
+}
+
+//查询银行登记
+func getBankRegistry(stub shim.ChaincodeStubInterface, bankName string) (BankRegistry, bool) {
+	var registry BankRegistry
+	key, err := constructBankKey(stub, bankName)
+	if err != nil {
+		return registry, false
+	}
+	b, err := stub.GetState(key)
+	if err != nil || b == nil {
+		return registry, false
+	}
+	if err := json.Unmarshal(b, &registry); err != nil {
+		return registry, false
+	}
+	return registry, true
+}
+
+//校验提交者是否属于该银行
+func checkBankPermission(stub shim.ChaincodeStubInterface, bankName string) error {
+	registry, ok := getBankRegistry(stub, bankName)
+	if !ok {
+		return fmt.Errorf("银行未登记：%s", bankName)
+	}
+	mspID, err := getCreatorMSP(stub)
+	if err != nil {
+		return err
+	}
+	if mspID != registry.MSPID {
+		return fmt.Errorf("无权操作该银行的数据：%s", bankName)
+	}
+	return nil
+}
+
+//校验提交者是否属于监管机构或该银行
+//bankName为空时表示查询所有银行的数据，只有监管机构可以查询
+func checkBankOrRegulatorPermission(stub shim.ChaincodeStubInterface, bankName string) error {
+	if err := checkRegulatorPermission(stub); err == nil {
+		return nil
+	}
+	if bankName == "" {
+		return fmt.Errorf("只有监管机构可以查询所有银行的数据")
+	}
+	return checkBankPermission(stub, bankName)
+}
+
+//登记银行，只有监管机构可以登记
+//-c '{"Args":["registerBank","银行名字","MSP ID"]}'
+func registerBank(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 2 {
+		return shim.Error("参数个数错误")
+	}
+	if args[0] == "" || args[1] == "" {
+		return shim.Error("银行名字和MSP ID不能为空")
+	}
+	if err := checkRegulatorPermission(stub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	registry := BankRegistry{
+		BankName: args[0],
+		MSPID:    args[1],
+	}
+	b, err := json.Marshal(registry)
+	if err != nil {
+		return shim.Error("序列化失败")
+	}
+	key, err := constructBankKey(stub, registry.BankName)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("创建key失败 %s", err))
+	}
+	if err := stub.PutState(key, b); err != nil {
+		return shim.Error(fmt.Sprintf("保存银行登记失败 %s", err))
+	}
+	return shim.Success([]byte("登记银行成功"))
+}
+
+//银行登记查询
+//-c '{"Args":["queryBank","银行名字"]}'
+func queryBank(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 1 {
+		return shim.Error("参数个数错误")
+	}
+	registry, ok := getBankRegistry(stub, args[0])
+	if !ok {
+		return shim.Error("银行未登记")
+	}
+	b, err := json.Marshal(registry)
+	if err != nil {
+		return shim.Error("序列化失败")
+	}
+	return shim.Success(b)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"sort"
+	"time"
+)
+
+//信用报告
+//-c '{"Args":["creditReport","账户key"]}'
+//汇总账户在各银行的未还金额、还款历史和按时还款比例
+//由客户本人或得到客户授权的银行查询
+func creditReport(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 1 {
+		return shim.Error("参数个数错误")
+	}
+	accountKey, err := resolveAccountKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//需要客户授权
+	if err := checkConsent(stub, accountKey, Consent_Scope_Report); err != nil {
+		return shim.Error(err.Error())
+	}
+	account, exist, err := getAccount(stub, accountKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !exist {
+		return shim.Error("账户不存在")
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	report := CreditReport{
+		AccountKey: account.AccountKey,
+		TxID:       stub.GetTxID(),
+		Time:       txTime.Format(Time_Layout),
+		Banks:      make([]BankExposure, 0),
+		Repayments: make([]RepaymentItem, 0),
+	}
+	//按往来银行的顺序汇总
+	exposures := make(map[string]*BankExposure)
+	for _, bankName := range account.Banks {
+		exposures[bankName] = &BankExposure{
+			BankName:            bankName,
+			LoanTxIDs:           make([]string, 0),
+			RepaymentTxIDs:      make([]string, 0),
+			WrittenOffLoanIDs:   make([]string, 0),
+			RestructuredLoanIDs: make([]string, 0),
+		}
+	}
+
+	for _, loanID := range account.Loans {
+		l, ok := getLoan(stub, loanID)
+		if !ok {
+			return shim.Error("查询贷款失败")
+		}
+		//未放款的申请不计入信用报告
+		if l.Status < Loan_Status_Disbursed {
+			continue
+		}
+		exposure, ok := exposures[l.BankName]
+		if !ok {
+			return shim.Error("贷款的银行不在账户的往来银行中")
+		}
+		if l.Balance > 0 {
+			exposure.Outstanding += l.Balance
+			exposure.LoanTxIDs = append(exposure.LoanTxIDs, l.LoanID)
+		}
+		if l.Status == Loan_Status_WrittenOff {
+			exposure.WrittenOff += l.WrittenOff
+			exposure.WrittenOffLoanIDs = append(exposure.WrittenOffLoanIDs, l.LoanID)
+		} else if l.Status == Loan_Status_Restructured {
+			exposure.RestructuredLoanIDs = append(exposure.RestructuredLoanIDs, l.LoanID)
+		}
+		for _, r := range l.Repayments {
+			exposure.RepaymentTxIDs = append(exposure.RepaymentTxIDs, r.TxID)
+			report.Repayments = append(report.Repayments, RepaymentItem{
+				BankName:        l.BankName,
+				LoanID:          l.LoanID,
+				RepaymentRecord: r,
+			})
+			if r.OnTime {
+				report.OnTimeCount++
+			}
+		}
+	}
+
+	for _, bankName := range account.Banks {
+		exposure := exposures[bankName]
+		report.TotalOutstanding += exposure.Outstanding
+		report.TotalWrittenOff += exposure.WrittenOff
+		report.Banks = append(report.Banks, *exposure)
+	}
+	//还款历史按时间排序
+	sort.SliceStable(report.Repayments, func(i, j int) bool {
+		return report.Repayments[i].Time < report.Repayments[j].Time
+	})
+	report.RepaymentCount = len(report.Repayments)
+	if report.RepaymentCount > 0 {
+		report.OnTimeRatio = float64(report.OnTimeCount) / float64(report.RepaymentCount)
+	}
+
+	b, err := json.Marshal(report)
+	if err != nil {
+		return shim.Error("序列化信用报告失败")
+	}
+	return shim.Success(b)
+}
+
+//银行贷款组合
+//-c '{"Args":["bankPortfolio","银行名字","开始时间(2006-01-02 15:04:05)","结束时间(2006-01-02 15:04:05)"]}'
+//由银行自己查询，遍历bank~loan索引统计未还、区间内还款、逾期和核销情况
+func bankPortfolio(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 3 {
+		return shim.Error("参数个数错误")
+	}
+	bankName := args[0]
+	if err := checkBankPermission(stub, bankName); err != nil {
+		return shim.Error(err.Error())
+	}
+	start, err := time.Parse(Time_Layout, args[1])
+	if err != nil {
+		return shim.Error("开始时间格式错误")
+	}
+	end, err := time.Parse(Time_Layout, args[2])
+	if err != nil {
+		return shim.Error("结束时间格式错误")
+	}
+	if !start.Before(end) {
+		return shim.Error("开始时间必须早于结束时间")
+	}
+
+	loanIDs, err := getBankLoanIDs(stub, bankName)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	portfolio := BankPortfolio{
+		BankName:           bankName,
+		PeriodStart:        args[1],
+		PeriodEnd:          args[2],
+		RepaymentTxIDs:     make([]string, 0),
+		DelinquentByBucket: make(map[string]int),
+	}
+	for _, bucket := range delinquencyBuckets {
+		portfolio.DelinquentByBucket[bucket] = 0
+	}
+	for _, loanID := range loanIDs {
+		l, ok := getLoan(stub, loanID)
+		if !ok {
+			return shim.Error("查询贷款失败")
+		}
+		if l.Balance > 0 {
+			portfolio.ActiveLoans++
+			portfolio.TotalOutstanding += l.Balance
+		}
+		if l.Delinquency != "" && l.Balance > 0 {
+			portfolio.DelinquentLoans++
+			portfolio.DelinquentOutstanding += l.Balance
+			portfolio.DelinquentByBucket[l.Delinquency] += l.Balance
+		}
+		for _, r := range l.Repayments {
+			if !inPeriod(r.Time, start, end) {
+				continue
+			}
+			portfolio.RepaidInPeriod += r.Amount
+			portfolio.RepaymentTxIDs = append(portfolio.RepaymentTxIDs, r.TxID)
+		}
+		if l.Status == Loan_Status_WrittenOff {
+			portfolio.WrittenOffLoans++
+			portfolio.TotalWrittenOff += l.WrittenOff
+			if inPeriod(loanStepTime(l, Loan_Status_WrittenOff), start, end) {
+				portfolio.WrittenOffInPeriod += l.WrittenOff
+			}
+		} else if l.Status == Loan_Status_Restructured {
+			if inPeriod(loanStepTime(l, Loan_Status_Restructured), start, end) {
+				portfolio.RestructuredInPeriod++
+			}
+		}
+	}
+
+	b, err := json.Marshal(portfolio)
+	if err != nil {
+		return shim.Error("序列化失败")
+	}
+	return shim.Success(b)
+}
+
+//时间是否在区间内，包含开始不包含结束
+func inPeriod(value string, start time.Time, end time.Time) bool {
+	t, err := time.Parse(Time_Layout, value)
+	if err != nil {
+		return false
+	}
+	return !t.Before(start) && t.Before(end)
+}
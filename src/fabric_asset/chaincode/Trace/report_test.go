@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+//icbc和ccb各放款一笔，icbc按时还了第一期，ccb第一期逾期后部分还款
+//等额本金，月利率1%：icbc 12000元12期，应还12780；ccb 6000元6期，应还6210
+func setupReport(t *testing.T) (*testStub, string, string, string) {
+	s, accountKey, icbcLoan := setupAccount(t)
+	s.mustInvoke("bindCustomer", accountKey, "icbc", testCustomerMSP+"/alice")
+	//未放款的申请
+	s.mustInvoke("applyLoan", accountKey, "icbc", "3000", "1200", "12", "1", "消费贷款")
+	ccbLoan := s.openLoan("CCBMSP", "ccb", accountKey, 6000, 6)
+
+	s.at("2018-06-20 10:00:00")
+	s.as("ICBCMSP", "teller").mustInvoke("repayment", accountKey, "icbc", "1120")
+	//icbc第二期8月1日到期，逾期14天；ccb第一期7月1日到期，逾期45天
+	s.at("2018-08-15 10:00:00")
+	s.as(testRegulatorMSP, "admin").mustInvoke("markOverdue")
+	s.as("CCBMSP", "teller").mustInvoke("repayment", accountKey, "ccb", "500")
+	return s, accountKey, icbcLoan, ccbLoan
+}
+
+func TestCreditReport(t *testing.T) {
+	s, accountKey, icbcLoan, ccbLoan := setupReport(t)
+
+	s.as(testCustomerMSP, "alice")
+	var report CreditReport
+	if err := json.Unmarshal(s.mustInvoke("creditReport", accountKey).Payload, &report); err != nil {
+		t.Fatal(err)
+	}
+	//未放款的申请不计入
+	if report.TotalOutstanding != 12780-1120+6210-500 || len(report.Banks) != 2 {
+		t.Fatalf("未还总额错误：%+v", report)
+	}
+	icbc, ccb := report.Banks[0], report.Banks[1]
+	if icbc.BankName != "icbc" || icbc.Outstanding != 11660 || len(icbc.LoanTxIDs) != 1 || icbc.LoanTxIDs[0] != icbcLoan {
+		t.Errorf("icbc的未还情况错误：%+v", icbc)
+	}
+	if ccb.BankName != "ccb" || ccb.Outstanding != 5710 || len(ccb.LoanTxIDs) != 1 || ccb.LoanTxIDs[0] != ccbLoan {
+		t.Errorf("ccb的未还情况错误：%+v", ccb)
+	}
+	if len(icbc.RepaymentTxIDs) != 1 || len(ccb.RepaymentTxIDs) != 1 {
+		t.Errorf("还款交易id错误：%+v %+v", icbc.RepaymentTxIDs, ccb.RepaymentTxIDs)
+	}
+	//icbc按时，ccb冲抵的是逾期的一期
+	if report.RepaymentCount != 2 || report.OnTimeCount != 1 || report.OnTimeRatio != 0.5 {
+		t.Errorf("还款统计错误：%d %d %v", report.RepaymentCount, report.OnTimeCount, report.OnTimeRatio)
+	}
+	if len(report.Repayments) != 2 || report.Repayments[0].BankName != "icbc" || !report.Repayments[0].OnTime || report.Repayments[1].OnTime {
+		t.Errorf("还款历史应按时间排序：%+v", report.Repayments)
+	}
+
+	//逾期分档
+	s.as(testRegulatorMSP, "admin")
+	for bucket, want := range map[string]string{Delinquency_1_30: icbcLoan, Delinquency_31_90: ccbLoan, Delinquency_Over90: ""} {
+		var loans []Loan
+		if err := json.Unmarshal(s.mustInvoke("queryDelinquent", bucket).Payload, &loans); err != nil {
+			t.Fatal(err)
+		}
+		if (want == "" && len(loans) != 0) || (want != "" && (len(loans) != 1 || loans[0].LoanID != want)) {
+			t.Errorf("%s分档的贷款错误：%+v", bucket, loans)
+		}
+	}
+}
+
+func TestCreditReportRequiresReportConsent(t *testing.T) {
+	s, accountKey, _, _ := setupReport(t)
+
+	s.as("CCBMSP", "teller")
+	expectRefused(t, "creditReport", s.invoke("creditReport", accountKey))
+	//查询历史的授权不能查询信用报告
+	s.as(testCustomerMSP, "alice").mustInvoke("grantConsent", accountKey, "ccb", Consent_Scope_History, "2019-01-01 00:00:00")
+	s.as("CCBMSP", "teller")
+	expectRefused(t, "creditReport", s.invoke("creditReport", accountKey))
+
+	s.as(testCustomerMSP, "alice").mustInvoke("grantConsent", accountKey, "ccb", Consent_Scope_Report, "2019-01-01 00:00:00")
+	s.as("CCBMSP", "teller").mustInvoke("creditReport", accountKey)
+	//授权到期后不能查询
+	s.at("2019-01-01 00:00:00")
+	expectRefused(t, "creditReport", s.invoke("creditReport", accountKey))
+}
+
+//查询银行贷款组合
+func queryPortfolio(t *testing.T, s *testStub, bankName string, start string, end string) BankPortfolio {
+	var portfolio BankPortfolio
+	if err := json.Unmarshal(s.mustInvoke("bankPortfolio", bankName, start, end).Payload, &portfolio); err != nil {
+		t.Fatal(err)
+	}
+	return portfolio
+}
+
+func TestBankPortfolio(t *testing.T) {
+	//icbc：alice 12000元12期，应还12780
+	s, alice, _ := setupAccount(t)
+	//ccb：alice 6000元6期，应还6210；bob 3000元3期，应还3060
+	s.openLoan("CCBMSP", "ccb", alice, 6000, 6)
+	bobCardNo := "110101199001015678"
+	bob := hashAccountKey(bobCardNo, testSalt)
+	s.withTransient(map[string][]byte{"CardNo": []byte(bobCardNo), "salt": []byte(testSalt)})
+	s.mustInvoke("applyLoan", "", "ccb", "3000", "1200", "3", "1", "消费贷款")
+	s.withTransient(nil)
+	s.openLoan("CCBMSP", "ccb", bob, 3000, 3)
+	//未放款的申请不计入
+	s.as("ICBCMSP", "teller").mustInvoke("applyLoan", bob, "icbc", "5000", "1200", "12", "1", "消费贷款")
+
+	s.at("2018-06-20 10:00:00")
+	s.mustInvoke("repayment", alice, "icbc", "1120")
+	s.at("2018-06-25 10:00:00")
+	s.as("CCBMSP", "teller").mustInvoke("repayment", bob, "ccb", "1030")
+	s.at("2018-08-15 10:00:00")
+	s.as(testRegulatorMSP, "admin").mustInvoke("markOverdue")
+
+	s.as("ICBCMSP", "teller")
+	icbc := queryPortfolio(t, s, "icbc", "2018-06-01 00:00:00", "2018-07-01 00:00:00")
+	if icbc.ActiveLoans != 1 || icbc.TotalOutstanding != 11660 || icbc.RepaidInPeriod != 1120 || len(icbc.RepaymentTxIDs) != 1 {
+		t.Errorf("icbc的贷款组合错误：%+v", icbc)
+	}
+	if icbc.DelinquentLoans != 1 || icbc.DelinquentOutstanding != 11660 || icbc.DelinquentByBucket[Delinquency_1_30] != 11660 || icbc.DelinquentByBucket[Delinquency_31_90] != 0 {
+		t.Errorf("icbc的逾期统计错误：%+v", icbc)
+	}
+	//区间包含开始不包含结束
+	if p := queryPortfolio(t, s, "icbc", "2018-06-20 10:00:00", "2018-06-21 00:00:00"); p.RepaidInPeriod != 1120 {
+		t.Errorf("开始时刻的还款应计入：%+v", p)
+	}
+	if p := queryPortfolio(t, s, "icbc", "2018-06-01 00:00:00", "2018-06-20 10:00:00"); p.RepaidInPeriod != 0 || p.TotalOutstanding != 11660 {
+		t.Errorf("结束时刻的还款不应计入：%+v", p)
+	}
+	//不能查询其他银行
+	expectRefused(t, "bankPortfolio", s.invoke("bankPortfolio", "ccb", "2018-06-01 00:00:00", "2018-07-01 00:00:00"))
+
+	s.as("CCBMSP", "teller")
+	ccb := queryPortfolio(t, s, "ccb", "2018-06-01 00:00:00", "2018-07-01 00:00:00")
+	if ccb.ActiveLoans != 2 || ccb.TotalOutstanding != 6210+2030 || ccb.RepaidInPeriod != 1030 {
+		t.Errorf("ccb的贷款组合错误：%+v", ccb)
+	}
+	if ccb.DelinquentLoans != 2 || ccb.DelinquentByBucket[Delinquency_1_30] != 2030 || ccb.DelinquentByBucket[Delinquency_31_90] != 6210 || ccb.DelinquentByBucket[Delinquency_Over90] != 0 {
+		t.Errorf("ccb的逾期统计错误：%+v", ccb)
+	}
+	expectRefused(t, "bankPortfolio", s.invoke("bankPortfolio", "ccb", "2018-07-01 00:00:00", "2018-06-01 00:00:00"))
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"time"
+)
+
+//不良贷款处置
+//重组：原贷款保留还款计划和还款记录，状态改为已重组，剩余欠款转为一笔新贷款，两笔贷款互相关联
+//核销：未还金额记为核销金额，未还金额清零
+
+//重组时转入新贷款的金额
+//已到期的期数未还部分全部转入，未到期的期数只转入未还的本金，每期的还款先冲抵利息
+func restructureAmount(l Loan, t time.Time) int {
+	if len(l.Schedule) == 0 {
+		return l.Balance
+	}
+	amount := 0
+	for _, inst := range l.Schedule {
+		unpaid := inst.Amount - inst.Paid
+		if unpaid <= 0 {
+			continue
+		}
+		if !isOnTime(t, inst.DueDate) || t.Format(Date_Layout) == inst.DueDate {
+			amount += unpaid
+		} else if unpaid > inst.Principal {
+			amount += inst.Principal
+		} else {
+			amount += unpaid
+		}
+	}
+	return amount
+}
+
+//贷款重组
+//-c '{"Args":["restructureLoan","贷款编号","新年利率(万分之一)","新期数","还款方式(1.等额本金 2.等额本息)","重组原因"]}'
+//由贷款所属银行提交，只能重组已放款且未还清的贷款，返回新贷款编号
+func restructureLoan(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 5 {
+		return shim.Error("参数个数错误")
+	}
+	rate, term, method, err := parseLoanTerms(args[1], args[2], args[3])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	reason := args[4]
+
+	old, ok := getLoan(stub, args[0])
+	if !ok {
+		return shim.Error("贷款不存在")
+	}
+	if err := checkBankPermission(stub, old.BankName); err != nil {
+		return shim.Error(err.Error())
+	}
+	if old.Status != Loan_Status_Disbursed {
+		return shim.Error(fmt.Sprintf("贷款状态为%s，不能处置", loanStatusNames[old.Status]))
+	}
+	if old.Balance <= 0 {
+		return shim.Error("贷款已还清")
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	amount := restructureAmount(old, txTime)
+	schedule, err := buildSchedule(amount, rate, term, method, txTime)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	l := Loan{
+		DocType:          Loan_DocType,
+		LoanID:           stub.GetTxID(),
+		AccountKey:       old.AccountKey,
+		BankName:         old.BankName,
+		Amount:           amount,
+		Rate:             rate,
+		Term:             term,
+		Method:           method,
+		Balance:          sumSchedule(schedule),
+		StartTime:        txTime.Format(Date_Layout),
+		EndTime:          schedule[len(schedule)-1].DueDate,
+		Schedule:         schedule,
+		Repayments:       make([]RepaymentRecord, 0),
+		Steps:            make([]LoanStep, 0),
+		Collaterals:      make([]string, 0),
+		RestructuredFrom: old.LoanID,
+	}
+	//新贷款不走审批，直接放款
+	if err := appendLoanStep(stub, &l, Loan_Status_Disbursed, fmt.Sprintf("重组自%s：%s", old.LoanID, reason)); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//原贷款的还款计划不变，未还金额转入新贷款
+	if err := transitLoan(stub, &old, Loan_Status_Restructured, reason); err != nil {
+		return shim.Error(err.Error())
+	}
+	old.Balance = 0
+	old.RestructuredTo = l.LoanID
+	if _, err := classifyLoan(stub, &old, txTime); err != nil {
+		return shim.Error(err.Error())
+	}
+	//抵押物转为担保新贷款
+	if err := transferCollaterals(stub, &old, &l); err != nil {
+		return shim.Error(err.Error())
+	}
+	if !putLoan(stub, old) {
+		return shim.Error("保存贷款失败")
+	}
+
+	account, exist, err := getAccount(stub, l.AccountKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !exist {
+		return shim.Error("账户不存在")
+	}
+	//重组不是借款或还款，账户历史中不记录银行操作
+	account.Bank = Bank{}
+	if err := addLoan(stub, &account, l); err != nil {
+		return shim.Error(err.Error())
+	}
+	if !putAccount(stub, account) {
+		return shim.Error("保存账户失败")
+	}
+	return shim.Success([]byte(l.LoanID))
+}
+
+//贷款核销
+//-c '{"Args":["writeOffLoan","贷款编号","核销原因"]}'
+//由贷款所属银行提交，只能核销已放款且未还清的贷款
+func writeOffLoan(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 2 {
+		return shim.Error("参数个数错误")
+	}
+	l, ok := getLoan(stub, args[0])
+	if !ok {
+		return shim.Error("贷款不存在")
+	}
+	if err := checkBankPermission(stub, l.BankName); err != nil {
+		return shim.Error(err.Error())
+	}
+	if l.Status != Loan_Status_Disbursed {
+		return shim.Error(fmt.Sprintf("贷款状态为%s，不能处置", loanStatusNames[l.Status]))
+	}
+	if l.Balance <= 0 {
+		return shim.Error("贷款已还清")
+	}
+	if err := transitLoan(stub, &l, Loan_Status_WrittenOff, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	l.WrittenOff = l.Balance
+	l.Balance = 0
+	if _, err := classifyLoan(stub, &l, txTime); err != nil {
+		return shim.Error(err.Error())
+	}
+	//核销后抵押物不再担保该贷款
+	if err := releaseCollaterals(stub, l); err != nil {
+		return shim.Error(err.Error())
+	}
+	if !putLoan(stub, l) {
+		return shim.Error("保存贷款失败")
+	}
+	return shim.Success([]byte(fmt.Sprintf("核销成功，核销金额%d", l.WrittenOff)))
+}
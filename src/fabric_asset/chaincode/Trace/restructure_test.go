@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestRestructureLoanValidatesTerms(t *testing.T) {
+	s, accountKey := setupConsent(t)
+
+	s.as("ICBCMSP", "teller")
+	loanID := string(s.mustInvoke("applyLoan", accountKey, "icbc", "12000", "1200", "12", "1", "经营贷款").Payload)
+	s.mustInvoke("reviewLoan", loanID, "资料齐全")
+	s.mustInvoke("approveLoan", loanID, "同意")
+	s.mustInvoke("disburseLoan", loanID, "放款")
+
+	//与申请相同的利率、期数和还款方式限制
+	cases := [][]string{
+		{"10001", "12", "1"},
+		{"-1", "12", "1"},
+		{"1200", "0", "1"},
+		{"1200", "361", "1"},
+		{"1200", "12", "3"},
+	}
+	for _, c := range cases {
+		expectRefused(t, "restructureLoan", s.invoke("restructureLoan", loanID, c[0], c[1], c[2], "展期"))
+	}
+
+	newID := string(s.mustInvoke("restructureLoan", loanID, "600", "360", "2", "展期").Payload)
+	l, ok := getLoan(s, newID)
+	if !ok || l.RestructuredFrom != loanID || l.Rate != 600 || l.Term != 360 {
+		t.Errorf("重组后的贷款错误：%+v", l)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+	"time"
+)
+
+//CouchDB富查询
+//只有状态数据库为CouchDB的peer支持，索引定义在META-INF/statedb/couchdb/indexes
+
+//贷款的数据类型
+const Loan_DocType = "loan"
+
+//每页最多条数
+const Max_Page_Size = 100
+
+//按条件查询贷款
+//-c '{"Args":["searchLoans","{\"BankName\":\"icbc\",\"Flag\":1,\"MinAmount\":1000,\"StartDate\":\"2010-01-01\",\"PageSize\":10,\"Page\":0}"]}'
+//银行只能查询自己的贷款，不传BankName时只有监管机构可以查询
+func searchLoans(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 1 {
+		return shim.Error("参数个数错误")
+	}
+	var search LoanSearch
+	if err := json.Unmarshal([]byte(args[0]), &search); err != nil {
+		return shim.Error("查询条件解析失败")
+	}
+	if err := checkBankOrRegulatorPermission(stub, search.BankName); err != nil {
+		return shim.Error(err.Error())
+	}
+	query, err := buildLoanQuery(search)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultsIterator, err := stub.GetQueryResult(query)
+	if err != nil {
+		return shim.Error(fmt.Sprintf("富查询失败 %s", err))
+	}
+	defer resultsIterator.Close()
+
+	result := LoanSearchResult{
+		Records:  make([]Loan, 0),
+		Page:     search.Page,
+		PageSize: search.PageSize,
+	}
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error("遍历查询结果失败")
+		}
+		//多取的一条只用来判断是否还有下一页
+		if len(result.Records) == search.PageSize {
+			result.HasMore = true
+			break
+		}
+		var l Loan
+		if err := json.Unmarshal(kv.Value, &l); err != nil {
+			return shim.Error("反序列化贷款失败")
+		}
+		result.Records = append(result.Records, l)
+	}
+
+	b, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error("序列化失败")
+	}
+	return shim.Success(b)
+}
+
+//根据查询条件生成Mango查询
+//分页使用limit和skip，多取一条判断是否还有下一页
+func buildLoanQuery(search LoanSearch) (string, error) {
+	if search.PageSize <= 0 || search.PageSize > Max_Page_Size {
+		return "", fmt.Errorf("每页条数必须在1到%d之间", Max_Page_Size)
+	}
+	if search.Page < 0 {
+		return "", fmt.Errorf("页码不能小于0")
+	}
+	if search.MinAmount < 0 || search.MaxAmount < 0 || (search.MaxAmount > 0 && search.MinAmount > search.MaxAmount) {
+		return "", fmt.Errorf("金额范围错误")
+	}
+	for _, date := range []string{search.StartDate, search.EndDate} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(Date_Layout, date); err != nil {
+			return "", fmt.Errorf("日期格式错误")
+		}
+	}
+
+	amount := make(map[string]interface{})
+	if search.MinAmount > 0 {
+		amount["$gte"] = search.MinAmount
+	}
+	if search.MaxAmount > 0 {
+		amount["$lte"] = search.MaxAmount
+	}
+
+	selector := map[string]interface{}{
+		"DocType": Loan_DocType,
+	}
+	if search.BankName != "" {
+		selector["BankName"] = search.BankName
+	}
+
+	switch search.Flag {
+	case Bank_Flag_Loan:
+		//未放款和被拒绝的申请不是贷款
+		selector["Status"] = map[string]interface{}{
+			"$in": []int{Loan_Status_Disbursed, Loan_Status_Restructured, Loan_Status_WrittenOff},
+		}
+		//日期为起始时间，格式同Date_Layout，可以直接按字符串比较
+		date := make(map[string]interface{})
+		if search.StartDate != "" {
+			date["$gte"] = search.StartDate
+		}
+		if search.EndDate != "" {
+			date["$lte"] = search.EndDate
+		}
+		if len(date) > 0 {
+			selector["StartTime"] = date
+		}
+		if len(amount) > 0 {
+			selector["Amount"] = amount
+		}
+	case Bank_Flag_Repayment:
+		//还款时间格式为Time_Layout，结束日期要包含当天
+		repayment := make(map[string]interface{})
+		date := make(map[string]interface{})
+		if search.StartDate != "" {
+			date["$gte"] = search.StartDate
+		}
+		if search.EndDate != "" {
+			date["$lt"] = search.EndDate + "~"
+		}
+		if len(date) > 0 {
+			repayment["Time"] = date
+		}
+		if len(amount) > 0 {
+			repayment["Amount"] = amount
+		}
+		if len(repayment) == 0 {
+			//只要有还款记录
+			repayment["TxID"] = map[string]interface{}{"$gt": ""}
+		}
+		selector["Repayments"] = map[string]interface{}{"$elemMatch": repayment}
+	default:
+		return "", fmt.Errorf("类型错误")
+	}
+
+	query := map[string]interface{}{
+		"selector": selector,
+		"limit":    search.PageSize + 1,
+		"skip":     search.Page * search.PageSize,
+	}
+	b, err := json.Marshal(query)
+	if err != nil {
+		return "", fmt.Errorf("生成查询失败")
+	}
+	return string(b), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+//解析生成的查询中的selector
+func querySelector(t *testing.T, search LoanSearch) map[string]interface{} {
+	query, err := buildLoanQuery(search)
+	if err != nil {
+		t.Fatalf("%+v: %s", search, err)
+	}
+	var parsed struct {
+		Selector map[string]interface{} `json:"selector"`
+	}
+	if err := json.Unmarshal([]byte(query), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Selector
+}
+
+func TestBuildLoanQueryExcludesApplications(t *testing.T) {
+	selector := querySelector(t, LoanSearch{BankName: "icbc", Flag: Bank_Flag_Loan, StartDate: "2018-01-01", PageSize: 10})
+	status, ok := selector["Status"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("按放款查询应按状态过滤：%v", selector)
+	}
+	in, _ := status["$in"].([]interface{})
+	got := make(map[int]bool)
+	for _, v := range in {
+		got[int(v.(float64))] = true
+	}
+	for _, s := range []int{Loan_Status_Applied, Loan_Status_Reviewing, Loan_Status_Approved, Loan_Status_Rejected} {
+		if got[s] {
+			t.Errorf("状态%s不应被查询", loanStatusNames[s])
+		}
+	}
+	for _, s := range []int{Loan_Status_Disbursed, Loan_Status_Restructured, Loan_Status_WrittenOff} {
+		if !got[s] {
+			t.Errorf("状态%s应被查询", loanStatusNames[s])
+		}
+	}
+
+	//有还款记录的一定已经放款
+	if selector := querySelector(t, LoanSearch{Flag: Bank_Flag_Repayment, PageSize: 10}); selector["Status"] != nil {
+		t.Errorf("按还款查询不需要状态过滤：%v", selector)
+	}
+}
+
+func TestBuildLoanQueryValidates(t *testing.T) {
+	cases := []LoanSearch{
+		{Flag: Bank_Flag_Loan, PageSize: 0},
+		{Flag: Bank_Flag_Loan, PageSize: Max_Page_Size + 1},
+		{Flag: Bank_Flag_Loan, PageSize: 10, Page: -1},
+		{Flag: Bank_Flag_Loan, PageSize: 10, MinAmount: 100, MaxAmount: 50},
+		{Flag: Bank_Flag_Loan, PageSize: 10, StartDate: "2018/01/01"},
+		{Flag: 3, PageSize: 10},
+	}
+	for _, c := range cases {
+		if _, err := buildLoanQuery(c); err == nil {
+			t.Errorf("%+v 应返回错误", c)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+//还款计划
+//放款时按利率和期数生成，每月一期，还款时按期数先后冲抵
+
+//还款方式
+const (
+	//等额本金
+	Loan_Method_EqualPrincipal = 1
+	//等额本息
+	Loan_Method_EqualInstallment = 2
+)
+
+//每期的状态
+const (
+	Installment_Status_Unpaid  = 1
+	Installment_Status_Paid    = 2
+	Installment_Status_Partial = 3
+	Installment_Status_Overdue = 4
+)
+
+//生成还款计划
+//rate为年利率，单位为万分之一；按月计息，月利率为rate/120000
+//全部使用有理数运算，利息和每期应还金额四舍五入到整数，本金的尾差放在最后一期
+func buildSchedule(amount int, rate int, term int, method int, start time.Time) ([]Installment, error) {
+	if amount <= 0 || term <= 0 {
+		return nil, fmt.Errorf("金额和期数必须大于0")
+	}
+	if rate < 0 {
+		return nil, fmt.Errorf("利率不能小于0")
+	}
+	monthRate := big.NewRat(int64(rate), 120000)
+
+	//等额本息每期应还的金额
+	payment := 0
+	if method == Loan_Method_EqualInstallment {
+		if rate == 0 {
+			payment = roundRat(big.NewRat(int64(amount), int64(term)))
+		} else {
+			//amount * r * (1+r)^n / ((1+r)^n - 1)
+			pow := new(big.Rat).SetInt64(1)
+			base := new(big.Rat).Add(big.NewRat(1, 1), monthRate)
+			for i := 0; i < term; i++ {
+				pow.Mul(pow, base)
+			}
+			x := new(big.Rat).Mul(big.NewRat(int64(amount), 1), monthRate)
+			x.Mul(x, pow)
+			x.Quo(x, new(big.Rat).Sub(pow, big.NewRat(1, 1)))
+			payment = roundRat(x)
+		}
+	} else if method != Loan_Method_EqualPrincipal {
+		return nil, fmt.Errorf("还款方式错误")
+	}
+
+	schedule := make([]Installment, 0, term)
+	remain := amount
+	for period := 1; period <= term; period++ {
+		interest := roundRat(new(big.Rat).Mul(big.NewRat(int64(remain), 1), monthRate))
+		var principal int
+		if period == term {
+			principal = remain
+		} else if method == Loan_Method_EqualPrincipal {
+			principal = amount / term
+		} else {
+			principal = payment - interest
+			if principal > remain {
+				principal = remain
+			}
+		}
+		remain -= principal
+
+		schedule = append(schedule, Installment{
+			Period:    period,
+			DueDate:   addMonths(start, period).Format(Date_Layout),
+			Principal: principal,
+			Interest:  interest,
+			Amount:    principal + interest,
+			Status:    Installment_Status_Unpaid,
+		})
+	}
+	return schedule, nil
+}
+
+//非负有理数四舍五入到整数
+func roundRat(x *big.Rat) int {
+	num := new(big.Int).Mul(x.Num(), big.NewInt(2))
+	num.Add(num, x.Denom())
+	den := new(big.Int).Mul(x.Denom(), big.NewInt(2))
+	return int(num.Quo(num, den).Int64())
+}
+
+//加上若干个月，日期超过当月最后一天时取当月最后一天
+//time.AddDate会把1月31日加一个月变成3月3日
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	last := time.Date(year, month+time.Month(months)+1, 0, 0, 0, 0, 0, t.Location()).Day()
+	if day > last {
+		day = last
+	}
+	return time.Date(year, month+time.Month(months), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+//按期冲抵一笔贷款，返回本笔贷款实际收到的金额
+//没有还款计划的贷款直接冲抵未还金额
+func allocateRepayment(l *Loan, amount int, txID string, t time.Time) int {
+	pay := l.Balance
+	if pay > amount {
+		pay = amount
+	}
+	if pay <= 0 {
+		return 0
+	}
+
+	onTime := true
+	if len(l.Schedule) == 0 {
+		onTime = isOnTime(t, l.EndTime)
+	} else {
+		remain := pay
+		for i := range l.Schedule {
+			if remain == 0 {
+				break
+			}
+			inst := &l.Schedule[i]
+			due := inst.Amount - inst.Paid
+			if due <= 0 {
+				continue
+			}
+			if due > remain {
+				due = remain
+			}
+			inst.Paid += due
+			remain -= due
+			if !isOnTime(t, inst.DueDate) {
+				onTime = false
+			}
+		}
+		refreshSchedule(l, t)
+	}
+
+	l.Balance -= pay
+	l.Repayments = append(l.Repayments, RepaymentRecord{
+		TxID:   txID,
+		Time:   t.Format(Time_Layout),
+		Amount: pay,
+		OnTime: onTime,
+	})
+	return pay
+}
+
+//根据已还金额和时间更新每期的状态
+func refreshSchedule(l *Loan, t time.Time) {
+	for i := range l.Schedule {
+		inst := &l.Schedule[i]
+		if inst.Paid >= inst.Amount {
+			inst.Status = Installment_Status_Paid
+		} else if !isOnTime(t, inst.DueDate) {
+			inst.Status = Installment_Status_Overdue
+		} else if inst.Paid > 0 {
+			inst.Status = Installment_Status_Partial
+		} else {
+			inst.Status = Installment_Status_Unpaid
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildSchedule(t *testing.T) {
+	type period struct {
+		due       string
+		principal int
+		interest  int
+	}
+	cases := []struct {
+		name   string
+		amount int
+		rate   int
+		term   int
+		method int
+		start  string
+		want   []period
+	}{
+		{
+			name: "等额本金，月末起息", amount: 12000, rate: 1200, term: 3,
+			method: Loan_Method_EqualPrincipal, start: "2018-01-31",
+			want: []period{
+				{"2018-02-28", 4000, 120},
+				{"2018-03-31", 4000, 80},
+				{"2018-04-30", 4000, 40},
+			},
+		},
+		{
+			name: "等额本金，尾差放在最后一期", amount: 1000, rate: 0, term: 3,
+			method: Loan_Method_EqualPrincipal, start: "2018-03-15",
+			want: []period{
+				{"2018-04-15", 333, 0},
+				{"2018-05-15", 333, 0},
+				{"2018-06-15", 334, 0},
+			},
+		},
+		{
+			name: "等额本息", amount: 10000, rate: 1200, term: 3,
+			method: Loan_Method_EqualInstallment, start: "2018-01-15",
+			want: []period{
+				{"2018-02-15", 3300, 100},
+				{"2018-03-15", 3333, 67},
+				{"2018-04-15", 3367, 34},
+			},
+		},
+		{
+			name: "等额本息，月末起息跨闰年", amount: 10000, rate: 1200, term: 3,
+			method: Loan_Method_EqualInstallment, start: "2019-12-31",
+			want: []period{
+				{"2020-01-31", 3300, 100},
+				{"2020-02-29", 3333, 67},
+				{"2020-03-31", 3367, 34},
+			},
+		},
+		{
+			name: "零利率等额本息", amount: 1000, rate: 0, term: 3,
+			method: Loan_Method_EqualInstallment, start: "2018-01-31",
+			want: []period{
+				{"2018-02-28", 333, 0},
+				{"2018-03-31", 333, 0},
+				{"2018-04-30", 334, 0},
+			},
+		},
+		{
+			name: "利息恰为0.5时进位", amount: 50, rate: 1200, term: 1,
+			method: Loan_Method_EqualPrincipal, start: "2018-05-31",
+			want: []period{
+				{"2018-06-30", 50, 1},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		start, err := time.Parse(Date_Layout, c.start)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		schedule, err := buildSchedule(c.amount, c.rate, c.term, c.method, start)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if len(schedule) != len(c.want) {
+			t.Fatalf("%s: 期数为%d，应为%d", c.name, len(schedule), len(c.want))
+		}
+		total := 0
+		for i, w := range c.want {
+			inst := schedule[i]
+			if inst.Period != i+1 || inst.DueDate != w.due || inst.Principal != w.principal || inst.Interest != w.interest {
+				t.Errorf("%s: 第%d期为%+v，应为%+v", c.name, i+1, inst, w)
+			}
+			if inst.Amount != inst.Principal+inst.Interest || inst.Status != Installment_Status_Unpaid {
+				t.Errorf("%s: 第%d期金额或状态错误：%+v", c.name, i+1, inst)
+			}
+			total += inst.Principal
+		}
+		if total != c.amount {
+			t.Errorf("%s: 本金合计为%d，应为%d", c.name, total, c.amount)
+		}
+	}
+}
+
+func TestBuildScheduleInvalid(t *testing.T) {
+	start := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := buildSchedule(0, 1200, 12, Loan_Method_EqualPrincipal, start); err == nil {
+		t.Error("金额为0时应返回错误")
+	}
+	if _, err := buildSchedule(1000, -1, 12, Loan_Method_EqualPrincipal, start); err == nil {
+		t.Error("利率为负时应返回错误")
+	}
+	if _, err := buildSchedule(1000, 1200, 12, 3, start); err == nil {
+		t.Error("还款方式错误时应返回错误")
+	}
+}
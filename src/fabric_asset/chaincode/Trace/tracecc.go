@@ -2,9 +2,11 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/protos/peer"
 	"strconv"
+	"time"
 )
 
 //定义贷款和还款
@@ -13,88 +15,370 @@ const (
 	Bank_Flag_Repayment = 2
 )
 
-//贷款
-//-c '{"Args":["loan","账户身份证号","银行名字","金额"]}'
-func loan(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+//交易时间和日期的格式
+const (
+	Time_Layout = "2006-01-02 15:04:05"
+	Date_Layout = "2006-01-02"
+)
+
+//贷款申请
+//-c '{"Args":["applyLoan","账户key","银行名字","金额","年利率(万分之一)","期数(月)","1.等额本金 2.等额本息","申请说明"]}'
+//由银行代客户提交，放款前不产生未还金额
+func applyLoan(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	//判断参数
-	if len(args) != 3 {
+	if len(args) != 7 {
 		return shim.Error("参数个数错误")
 	}
+	if args[1] == "" {
+		return shim.Error("银行名字不能为空")
+	}
+	//只有银行自己能登记贷款
+	if err := checkBankPermission(stub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
 	//判断类型
 	v, err := strconv.Atoi(args[2])
-	if err != nil {
+	if err != nil || v <= 0 {
 		return shim.Error("类型错误")
 	}
+	rate, term, method, err := parseLoanTerms(args[3], args[4], args[5])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//查询账户，不存在则开户
+	accountKey, err := resolveAccountKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	account, exist, err := getAccount(stub, accountKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//开户时必须通过transient传入身份证号和盐，由链码计算账户key
+	if !exist {
+		_, _, ok, err := getTransientCardNo(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if !ok {
+			return shim.Error("开户需要在transient中传入CardNo和salt")
+		}
+	}
 
 	//组装数据
-	bank := Bank{
-		BankName:  args[1],
-		Amount:    v,
-		Flag:      Bank_Flag_Loan,
-		StartTime: "2011-01-10",
-		EndTime:   "2021-01-09",
+	l := Loan{
+		DocType:     Loan_DocType,
+		LoanID:      stub.GetTxID(),
+		AccountKey:  account.AccountKey,
+		BankName:    args[1],
+		Amount:      v,
+		Rate:        rate,
+		Term:        term,
+		Method:      method,
+		Schedule:    make([]Installment, 0),
+		Repayments:  make([]RepaymentRecord, 0),
+		Steps:       make([]LoanStep, 0),
+		Collaterals: make([]string, 0),
 	}
-	account := Account{
-		CardNo:   args[0],
-		Aname:    "jack",
-		Gender:   "男",
-		Mobile:   "1599999",
-		Bank:     bank,
-		Historys: nil,
+	if err := transitLoan(stub, &l, Loan_Status_Applied, args[6]); err != nil {
+		return shim.Error(err.Error())
+	}
+	//申请不是贷款或还款，不保留上一次的银行记录，以免账户历史中重复出现
+	account.Bank = Bank{}
+	if err := addLoan(stub, &account, l); err != nil {
+		return shim.Error(err.Error())
 	}
 
 	//保存状态
 	b := putAccount(stub, account)
 	if !b {
-		return shim.Error("保存贷款数据失败")
+		return shim.Error("保存贷款申请失败")
+	}
+	return shim.Success([]byte(l.LoanID))
+}
+
+//解析贷款条件，申请和重组共用
+//年利率单位为万分之一，不超过100%；期数按月，不超过30年
+func parseLoanTerms(rateArg string, termArg string, methodArg string) (int, int, int, error) {
+	rate, err := strconv.Atoi(rateArg)
+	if err != nil || rate < 0 || rate > 10000 {
+		return 0, 0, 0, fmt.Errorf("利率错误")
+	}
+	term, err := strconv.Atoi(termArg)
+	if err != nil || term <= 0 || term > 360 {
+		return 0, 0, 0, fmt.Errorf("期数错误")
+	}
+	method, err := strconv.Atoi(methodArg)
+	if err != nil || (method != Loan_Method_EqualPrincipal && method != Loan_Method_EqualInstallment) {
+		return 0, 0, 0, fmt.Errorf("还款方式错误")
 	}
-	return shim.Success([]byte("保存贷款数据成功"))
+	return rate, term, method, nil
+}
+
+//查询账户
+//账户不存在时返回只有账户key的新账户和false
+func getAccount(stub shim.ChaincodeStubInterface, accountKey string) (Account, bool, error) {
+	account := Account{
+		AccountKey: accountKey,
+		Banks:      make([]string, 0),
+		Loans:      make([]string, 0),
+	}
+	accBytes, err := stub.GetState(accountKey)
+	if err != nil {
+		return account, false, fmt.Errorf("查询账户失败")
+	}
+	if accBytes == nil {
+		return account, false, nil
+	}
+	if err := json.Unmarshal(accBytes, &account); err != nil {
+		return account, false, fmt.Errorf("反序列化账户失败")
+	}
+	return account, true, nil
 }
 
 //序列化保存
 //参数将要保存的账户传过来，返回布尔
 func putAccount(stub shim.ChaincodeStubInterface, account Account) bool {
+	//交易历史从账本历史中查询，不保存在状态中
+	account.Historys = nil
 	//序列化
 	accBytes, err := json.Marshal(account)
 	if err != nil {
 		return false
 	}
 	//保存数据
-	err = stub.PutState(account.CardNo, accBytes)
+	err = stub.PutState(account.AccountKey, accBytes)
+	if err != nil {
+		return false
+	}
+	return true
+}
+
+//贷款的key
+func constructLoanKey(stub shim.ChaincodeStubInterface, loanID string) (string, error) {
+	return stub.CreateCompositeKey("loan", []string{loanID})
+}
+
+//查询贷款
+func getLoan(stub shim.ChaincodeStubInterface, loanID string) (Loan, bool) {
+	var l Loan
+	key, err := constructLoanKey(stub, loanID)
+	if err != nil {
+		return l, false
+	}
+	b, err := stub.GetState(key)
+	if err != nil || b == nil {
+		return l, false
+	}
+	if err := json.Unmarshal(b, &l); err != nil {
+		return l, false
+	}
+	return l, true
+}
+
+//保存贷款
+func putLoan(stub shim.ChaincodeStubInterface, l Loan) bool {
+	key, err := constructLoanKey(stub, l.LoanID)
 	if err != nil {
 		return false
 	}
+	b, err := json.Marshal(l)
+	if err != nil {
+		return false
+	}
+	if err := stub.PutState(key, b); err != nil {
+		return false
+	}
 	return true
 }
 
+//将贷款挂到账户下，并维护银行的索引
+//bank~loan：银行的所有贷款
+//申请阶段只挂贷款，往来银行在放款时由addBank记录
+func addLoan(stub shim.ChaincodeStubInterface, account *Account, l Loan) error {
+	account.Loans = append(account.Loans, l.LoanID)
+
+	loanKey, err := stub.CreateCompositeKey("bank~loan", []string{l.BankName, l.LoanID})
+	if err != nil {
+		return fmt.Errorf("创建key失败 %s", err)
+	}
+	if err := stub.PutState(loanKey, []byte{0x00}); err != nil {
+		return fmt.Errorf("保存银行贷款索引失败 %s", err)
+	}
+	if !putLoan(stub, l) {
+		return fmt.Errorf("保存贷款失败")
+	}
+	return nil
+}
+
+//记录账户的往来银行，并维护bank~account索引：银行的所有客户
+//只在放款时调用，被拒绝或未放款的申请不算往来
+func addBank(stub shim.ChaincodeStubInterface, account *Account, bankName string) error {
+	if hasBank(*account, bankName) {
+		return nil
+	}
+	account.Banks = append(account.Banks, bankName)
+	indexKey, err := stub.CreateCompositeKey("bank~account", []string{bankName, account.AccountKey})
+	if err != nil {
+		return fmt.Errorf("创建key失败 %s", err)
+	}
+	if err := stub.PutState(indexKey, []byte{0x00}); err != nil {
+		return fmt.Errorf("保存银行客户索引失败 %s", err)
+	}
+	return nil
+}
+
+//账户是否与该银行有往来
+func hasBank(account Account, bankName string) bool {
+	for _, name := range account.Banks {
+		if name == bankName {
+			return true
+		}
+	}
+	return false
+}
+
+//银行的所有贷款编号
+func getBankLoanIDs(stub shim.ChaincodeStubInterface, bankName string) ([]string, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("bank~loan", []string{bankName})
+	if err != nil {
+		return nil, fmt.Errorf("查询银行贷款失败")
+	}
+	defer resultsIterator.Close()
+
+	loanIDs := make([]string, 0)
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("遍历银行贷款失败")
+		}
+		_, keys, err := stub.SplitCompositeKey(kv.Key)
+		if err != nil || len(keys) != 2 {
+			return nil, fmt.Errorf("解析key失败")
+		}
+		loanIDs = append(loanIDs, keys[1])
+	}
+	return loanIDs, nil
+}
+
+//所有贷款编号
+func getAllLoanIDs(stub shim.ChaincodeStubInterface) ([]string, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("loan", []string{})
+	if err != nil {
+		return nil, fmt.Errorf("查询贷款失败")
+	}
+	defer resultsIterator.Close()
+
+	loanIDs := make([]string, 0)
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("遍历贷款失败")
+		}
+		_, keys, err := stub.SplitCompositeKey(kv.Key)
+		if err != nil || len(keys) != 1 {
+			return nil, fmt.Errorf("解析key失败")
+		}
+		loanIDs = append(loanIDs, keys[0])
+	}
+	return loanIDs, nil
+}
+
 //还款
-//-c '{"Args":["repayment","账户身份证号","银行名字","金额"]}'
+//-c '{"Args":["repayment","账户key","银行名字","金额","贷款编号(可选)"]}'
+//不指定贷款时按放款先后顺序冲抵该银行的贷款，每笔贷款内按期数先后冲抵
 func repayment(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	//判断参数
-	if len(args) != 3 {
+	if len(args) != 3 && len(args) != 4 {
 		return shim.Error("参数个数错误")
 	}
 	//判断类型
 	v, err := strconv.Atoi(args[2])
-	if err != nil {
+	if err != nil || v <= 0 {
 		return shim.Error("类型错误")
 	}
+	loanID := ""
+	if len(args) == 4 {
+		loanID = args[3]
+	}
+
+	accountKey, err := resolveAccountKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	account, exist, err := getAccount(stub, accountKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !exist {
+		return shim.Error("账户不存在")
+	}
+	bankName := args[1]
+	//只有银行自己能登记还款
+	if err := checkBankPermission(stub, bankName); err != nil {
+		return shim.Error(err.Error())
+	}
+	if !hasBank(account, bankName) {
+		return shim.Error("账户在该银行没有贷款")
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//取出该银行未还清的贷款
+	loans := make([]Loan, 0)
+	balance := 0
+	for _, id := range account.Loans {
+		if loanID != "" && id != loanID {
+			continue
+		}
+		l, ok := getLoan(stub, id)
+		if !ok {
+			return shim.Error("查询贷款失败")
+		}
+		if l.BankName != bankName || l.Balance <= 0 {
+			continue
+		}
+		loans = append(loans, l)
+		balance += l.Balance
+	}
+	if len(loans) == 0 {
+		return shim.Error("没有未还清的贷款")
+	}
+	if v > balance {
+		return shim.Error("还款金额超过未还金额")
+	}
+
+	//依次冲抵
+	remain := v
+	for _, l := range loans {
+		if remain == 0 {
+			break
+		}
+		remain -= allocateRepayment(&l, remain, stub.GetTxID(), txTime)
+		//还款后逾期状态可能变化
+		if _, err := classifyLoan(stub, &l, txTime); err != nil {
+			return shim.Error(err.Error())
+		}
+		//还清后解除抵押
+		if l.Balance == 0 {
+			if err := releaseCollaterals(stub, l); err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+		if !putLoan(stub, l) {
+			return shim.Error("保存贷款失败")
+		}
+	}
 
 	//组装数据
-	bank := Bank{
-		BankName:  args[1],
+	account.Bank = Bank{
+		BankName:  bankName,
 		Amount:    v,
 		Flag:      Bank_Flag_Repayment,
-		StartTime: "2011-01-10",
-		EndTime:   "2021-01-09",
-	}
-	account := Account{
-		CardNo:   args[0],
-		Aname:    "jack",
-		Gender:   "男",
-		Mobile:   "1599999",
-		Bank:     bank,
-		Historys: nil,
+		StartTime: txTime.Format(Date_Layout),
 	}
 
 	b := putAccount(stub, account)
@@ -103,3 +387,245 @@ func repayment(stub shim.ChaincodeStubInterface, args []string) peer.Response {
 	}
 	return shim.Success([]byte("存款成功"))
 }
+
+//是否在应还日期当天或之前
+//没有日期或格式无法解析时视为按时
+func isOnTime(t time.Time, dueDate string) bool {
+	if dueDate == "" {
+		return true
+	}
+	due, err := time.Parse(Date_Layout, dueDate)
+	if err != nil {
+		return true
+	}
+	return t.Before(due.AddDate(0, 0, 1))
+}
+
+//还款计划的应还总额
+func sumSchedule(schedule []Installment) int {
+	total := 0
+	for _, inst := range schedule {
+		total += inst.Amount
+	}
+	return total
+}
+
+//查询账户往来的所有银行
+//-c '{"Args":["queryAccountBanks","账户key"]}'
+//由客户本人或得到客户授权的银行查询
+func queryAccountBanks(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 1 {
+		return shim.Error("参数个数错误")
+	}
+	accountKey, err := resolveAccountKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//需要客户授权
+	if err := checkConsent(stub, accountKey, Consent_Scope_History); err != nil {
+		return shim.Error(err.Error())
+	}
+	account, exist, err := getAccount(stub, accountKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !exist {
+		return shim.Error("账户不存在")
+	}
+	b, err := json.Marshal(account.Banks)
+	if err != nil {
+		return shim.Error("序列化失败")
+	}
+	return shim.Success(b)
+}
+
+//查询银行的所有客户
+//-c '{"Args":["queryBankAccounts","银行名字"]}'
+//由银行自己或监管机构查询
+func queryBankAccounts(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 1 {
+		return shim.Error("参数个数错误")
+	}
+	if err := checkBankOrRegulatorPermission(stub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("bank~account", []string{args[0]})
+	if err != nil {
+		return shim.Error("查询银行客户失败")
+	}
+	defer resultsIterator.Close()
+
+	accountKeys := make([]string, 0)
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error("遍历银行客户失败")
+		}
+		_, keys, err := stub.SplitCompositeKey(kv.Key)
+		if err != nil || len(keys) != 2 {
+			return shim.Error("解析key失败")
+		}
+		accountKeys = append(accountKeys, keys[1])
+	}
+	b, err := json.Marshal(accountKeys)
+	if err != nil {
+		return shim.Error("序列化失败")
+	}
+	return shim.Success(b)
+}
+
+//查询账户的贷款
+//-c '{"Args":["queryLoans","账户key","银行名字(可为空)"]}'
+//由客户本人或得到客户授权的银行查询
+func queryLoans(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("参数个数错误")
+	}
+	accountKey, err := resolveAccountKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//需要客户授权
+	if err := checkConsent(stub, accountKey, Consent_Scope_History); err != nil {
+		return shim.Error(err.Error())
+	}
+	account, exist, err := getAccount(stub, accountKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !exist {
+		return shim.Error("账户不存在")
+	}
+	bankName := ""
+	if len(args) == 2 {
+		bankName = args[1]
+	}
+
+	loans := make([]Loan, 0)
+	for _, loanID := range account.Loans {
+		l, ok := getLoan(stub, loanID)
+		if !ok {
+			return shim.Error("查询贷款失败")
+		}
+		if bankName != "" && l.BankName != bankName {
+			continue
+		}
+		loans = append(loans, l)
+	}
+	b, err := json.Marshal(loans)
+	if err != nil {
+		return shim.Error("序列化失败")
+	}
+	return shim.Success(b)
+}
+
+//交易时间
+//各背书节点取到的是同一个时间，可以写入账本
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil || ts == nil {
+		return time.Time{}, fmt.Errorf("获取交易时间失败")
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
+
+//账户历史查询
+//-c '{"Args":["queryAccountHistory","账户key","银行名字(可为空)","1.贷款 2.还款(可为空)"]}'
+//返回当前账户，Historys中为账本中该账户的所有历史版本
+//由客户本人或得到客户授权的银行查询
+func queryAccountHistory(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	//判断参数
+	if len(args) < 1 || len(args) > 3 {
+		return shim.Error("参数个数错误")
+	}
+	accountKey, err := resolveAccountKey(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	//可选的过滤条件
+	bankName := ""
+	if len(args) > 1 {
+		bankName = args[1]
+	}
+	flag := 0
+	if len(args) > 2 && args[2] != "" {
+		v, err := strconv.Atoi(args[2])
+		if err != nil || (v != Bank_Flag_Loan && v != Bank_Flag_Repayment) {
+			return shim.Error("类型错误")
+		}
+		flag = v
+	}
+	//需要客户授权
+	if err := checkConsent(stub, accountKey, Consent_Scope_History); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	historys, err := getAccountHistory(stub, accountKey, bankName, flag)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	//当前账户，已删除的账户只返回账户key
+	account := Account{AccountKey: accountKey}
+	accBytes, err := stub.GetState(accountKey)
+	if err != nil {
+		return shim.Error("查询账户失败")
+	}
+	if accBytes == nil && len(historys) == 0 {
+		return shim.Error("账户不存在")
+	}
+	if accBytes != nil {
+		if err := json.Unmarshal(accBytes, &account); err != nil {
+			return shim.Error("反序列化账户失败")
+		}
+	}
+	account.Historys = historys
+
+	accBytes, err = json.Marshal(account)
+	if err != nil {
+		return shim.Error("序列化账户失败")
+	}
+	return shim.Success(accBytes)
+}
+
+//遍历账本中账户的历史版本
+//bankName为空、flag为0时不过滤
+func getAccountHistory(stub shim.ChaincodeStubInterface, accountKey string, bankName string, flag int) ([]HistoryItem, error) {
+	resultsIterator, err := stub.GetHistoryForKey(accountKey)
+	if err != nil {
+		return nil, fmt.Errorf("查询账户历史失败")
+	}
+	defer resultsIterator.Close()
+
+	historys := make([]HistoryItem, 0)
+	for resultsIterator.HasNext() {
+		historyData, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("遍历账户历史失败")
+		}
+
+		item := HistoryItem{
+			TxID:     historyData.TxId,
+			IsDelete: historyData.IsDelete,
+		}
+		if historyData.Timestamp != nil {
+			item.Timestamp = time.Unix(historyData.Timestamp.Seconds, int64(historyData.Timestamp.Nanos)).UTC().Format(Time_Layout)
+		}
+		//删除操作没有账户数据
+		if !historyData.IsDelete && historyData.Value != nil {
+			if err := json.Unmarshal(historyData.Value, &item.Account); err != nil {
+				return nil, fmt.Errorf("反序列化账户历史失败")
+			}
+		}
+
+		//按银行和贷款/还款过滤，删除记录没有银行信息，过滤时跳过
+		if bankName != "" && item.Account.Bank.BankName != bankName {
+			continue
+		}
+		if flag != 0 && item.Account.Bank.Flag != flag {
+			continue
+		}
+		historys = append(historys, item)
+	}
+	return historys, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMultipleBankRelationships(t *testing.T) {
+	s, accountKey, icbcLoan := setupAccount(t)
+	s.mustInvoke("bindCustomer", accountKey, "icbc", testCustomerMSP+"/alice")
+
+	//申请不算往来，放款后才记录银行
+	s.as("CCBMSP", "teller")
+	ccbLoan := string(s.mustInvoke("applyLoan", accountKey, "ccb", "6000", "1200", "6", "1", "消费贷款").Payload)
+	s.as(testCustomerMSP, "alice")
+	var banks []string
+	if err := json.Unmarshal(s.mustInvoke("queryAccountBanks", accountKey).Payload, &banks); err != nil {
+		t.Fatal(err)
+	}
+	if len(banks) != 1 || banks[0] != "icbc" {
+		t.Errorf("未放款的银行不应是往来银行：%v", banks)
+	}
+
+	s.as("CCBMSP", "teller")
+	s.mustInvoke("reviewLoan", ccbLoan, "资料齐全")
+	s.mustInvoke("approveLoan", ccbLoan, "同意")
+	s.mustInvoke("disburseLoan", ccbLoan, "放款")
+	//同一银行的第二笔贷款不重复记录
+	s.openLoan("ICBCMSP", "icbc", accountKey, 3000, 3)
+
+	s.as(testCustomerMSP, "alice")
+	if err := json.Unmarshal(s.mustInvoke("queryAccountBanks", accountKey).Payload, &banks); err != nil {
+		t.Fatal(err)
+	}
+	if len(banks) != 2 || banks[0] != "icbc" || banks[1] != "ccb" {
+		t.Errorf("往来银行错误：%v", banks)
+	}
+	var loans []Loan
+	if err := json.Unmarshal(s.mustInvoke("queryLoans", accountKey, "ccb").Payload, &loans); err != nil {
+		t.Fatal(err)
+	}
+	if len(loans) != 1 || loans[0].LoanID != ccbLoan {
+		t.Errorf("ccb的贷款错误：%+v", loans)
+	}
+	if err := json.Unmarshal(s.mustInvoke("queryLoans", accountKey).Payload, &loans); err != nil {
+		t.Fatal(err)
+	}
+	if len(loans) != 3 {
+		t.Errorf("账户应有3笔贷款：%d", len(loans))
+	}
+
+	//两家银行的客户列表中都有该账户
+	for _, c := range [][]string{{"ICBCMSP", "icbc"}, {"CCBMSP", "ccb"}} {
+		s.as(c[0], "teller")
+		var accountKeys []string
+		if err := json.Unmarshal(s.mustInvoke("queryBankAccounts", c[1]).Payload, &accountKeys); err != nil {
+			t.Fatal(err)
+		}
+		if len(accountKeys) != 1 || accountKeys[0] != accountKey {
+			t.Errorf("%s的客户错误：%v", c[1], accountKeys)
+		}
+	}
+
+	//还款只冲抵指定银行的贷款
+	s.as("CCBMSP", "teller")
+	s.mustInvoke("repayment", accountKey, "ccb", "500")
+	if l, _ := getLoan(s, icbcLoan); len(l.Repayments) != 0 {
+		t.Errorf("ccb的还款不应冲抵icbc的贷款：%+v", l.Repayments)
+	}
+	if l, _ := getLoan(s, ccbLoan); len(l.Repayments) != 1 || l.Repayments[0].Amount != 500 {
+		t.Errorf("ccb的还款记录错误：%+v", l.Repayments)
+	}
+	//没有往来的银行不能登记还款
+	s.as(testRegulatorMSP, "admin").mustInvoke("registerBank", "abc", "ABCMSP")
+	s.as("ABCMSP", "teller")
+	expectRefused(t, "repayment", s.invoke("repayment", accountKey, "abc", "100"))
+}
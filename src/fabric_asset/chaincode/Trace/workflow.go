@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/peer"
+)
+
+//贷款审批流程
+//申请 -> 审核 -> 批准/拒绝 -> 放款 -> 重组/核销，每一步记录操作人和原因
+
+//贷款状态
+const (
+	Loan_Status_Applied   = 1
+	Loan_Status_Reviewing = 2
+	Loan_Status_Approved  = 3
+	Loan_Status_Rejected  = 4
+	Loan_Status_Disbursed = 5
+	//已重组，剩余欠款转入新贷款
+	Loan_Status_Restructured = 6
+	//已核销
+	Loan_Status_WrittenOff = 7
+)
+
+//状态名，用于错误信息
+var loanStatusNames = map[int]string{
+	Loan_Status_Applied:      "已申请",
+	Loan_Status_Reviewing:    "审核中",
+	Loan_Status_Approved:     "已批准",
+	Loan_Status_Rejected:     "已拒绝",
+	Loan_Status_Disbursed:    "已放款",
+	Loan_Status_Restructured: "已重组",
+	Loan_Status_WrittenOff:   "已核销",
+}
+
+//合法的状态变更，0表示新建
+var loanTransitions = map[int][]int{
+	0:                     {Loan_Status_Applied},
+	Loan_Status_Applied:   {Loan_Status_Reviewing, Loan_Status_Rejected},
+	Loan_Status_Reviewing: {Loan_Status_Approved, Loan_Status_Rejected},
+	Loan_Status_Approved:  {Loan_Status_Disbursed},
+	Loan_Status_Disbursed: {Loan_Status_Restructured, Loan_Status_WrittenOff},
+}
+
+//变更贷款状态并记录操作人和原因
+func transitLoan(stub shim.ChaincodeStubInterface, l *Loan, to int, reason string) error {
+	legal := false
+	for _, status := range loanTransitions[l.Status] {
+		if status == to {
+			legal = true
+			break
+		}
+	}
+	if !legal {
+		return fmt.Errorf("贷款状态为%s，不能变更为%s", loanStatusNames[l.Status], loanStatusNames[to])
+	}
+	return appendLoanStep(stub, l, to, reason)
+}
+
+//设置贷款状态并记录一步流程
+func appendLoanStep(stub shim.ChaincodeStubInterface, l *Loan, to int, reason string) error {
+	operator, err := getCreatorIdentity(stub)
+	if err != nil {
+		return err
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+
+	l.Status = to
+	l.Steps = append(l.Steps, LoanStep{
+		Status:   to,
+		Operator: operator,
+		Reason:   reason,
+		TxID:     stub.GetTxID(),
+		Time:     txTime.Format(Time_Layout),
+	})
+	return nil
+}
+
+//贷款变更为某个状态的时间，没有时为空
+func loanStepTime(l Loan, status int) string {
+	for _, step := range l.Steps {
+		if step.Status == status {
+			return step.Time
+		}
+	}
+	return ""
+}
+
+//审核贷款
+//-c '{"Args":["reviewLoan","贷款编号","审核说明"]}'
+func reviewLoan(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	return changeLoanStatus(stub, args, Loan_Status_Reviewing)
+}
+
+//批准贷款
+//-c '{"Args":["approveLoan","贷款编号","批准说明"]}'
+func approveLoan(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	return changeLoanStatus(stub, args, Loan_Status_Approved)
+}
+
+//拒绝贷款
+//-c '{"Args":["rejectLoan","贷款编号","拒绝原因"]}'
+func rejectLoan(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	return changeLoanStatus(stub, args, Loan_Status_Rejected)
+}
+
+//审核、批准、拒绝只变更状态，由贷款所属银行提交
+func changeLoanStatus(stub shim.ChaincodeStubInterface, args []string, to int) peer.Response {
+	if len(args) != 2 {
+		return shim.Error("参数个数错误")
+	}
+	l, ok := getLoan(stub, args[0])
+	if !ok {
+		return shim.Error("贷款不存在")
+	}
+	if err := checkBankPermission(stub, l.BankName); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := transitLoan(stub, &l, to, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	//拒绝后解除抵押
+	if to == Loan_Status_Rejected {
+		if err := releaseCollaterals(stub, l); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if !putLoan(stub, l) {
+		return shim.Error("保存贷款失败")
+	}
+	return shim.Success([]byte(fmt.Sprintf("贷款%s", loanStatusNames[to])))
+}
+
+//放款
+//-c '{"Args":["disburseLoan","贷款编号","放款说明"]}'
+//起始时间为放款的交易日期，同时生成还款计划和未还金额
+func disburseLoan(stub shim.ChaincodeStubInterface, args []string) peer.Response {
+	if len(args) != 2 {
+		return shim.Error("参数个数错误")
+	}
+	l, ok := getLoan(stub, args[0])
+	if !ok {
+		return shim.Error("贷款不存在")
+	}
+	if err := checkBankPermission(stub, l.BankName); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := transitLoan(stub, &l, Loan_Status_Disbursed, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	schedule, err := buildSchedule(l.Amount, l.Rate, l.Term, l.Method, txTime)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	l.Schedule = schedule
+	l.Balance = sumSchedule(schedule)
+	l.StartTime = txTime.Format(Date_Layout)
+	l.EndTime = schedule[len(schedule)-1].DueDate
+
+	account, exist, err := getAccount(stub, l.AccountKey)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !exist {
+		return shim.Error("账户不存在")
+	}
+	account.Bank = Bank{
+		BankName:  l.BankName,
+		Amount:    l.Amount,
+		Flag:      Bank_Flag_Loan,
+		StartTime: l.StartTime,
+		EndTime:   l.EndTime,
+	}
+	if err := addBank(stub, &account, l.BankName); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if !putLoan(stub, l) {
+		return shim.Error("保存贷款失败")
+	}
+	if !putAccount(stub, account) {
+		return shim.Error("保存贷款数据失败")
+	}
+	return shim.Success([]byte("放款成功"))
+}
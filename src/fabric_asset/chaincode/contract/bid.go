@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"fabric_asset/client"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//投标记录
+//每次响应合约都保存一条投标，key为bid~合同代码~投标方用户代码~交易id
+//每个投标方只有一条有效投标，再次响应时之前的投标改为已修改
+
+//投标状态
+const (
+	//有效
+	Bid_Status_Active = "active"
+	//已被新的投标替代
+	Bid_Status_Revised = "revised"
+	//密封投标未揭标或与承诺不一致，已作废
+	Bid_Status_Disqualified = "disqualified"
+)
+
+//投标
+type Bid struct {
+	//id
+	TaskId string `json:"task_id"`
+	//投标方用户代码
+	UserCode string `json:"user_code"`
+	//合同代码
+	ContractCode string `json:"contract_code"`
+	//投标金额，密封投标揭标前为0
+	Amount int `json:"amount"`
+	//投标条款
+	Terms string `json:"terms"`
+	//密封投标的承诺哈希
+	Commitment string `json:"commitment"`
+	//密封投标揭标时的盐
+	Salt string `json:"salt"`
+	//密封投标是否已揭标
+	Revealed bool `json:"revealed"`
+	//揭标时间
+	RevealTime string `json:"reveal_time"`
+	//投标的交易id
+	TxId string `json:"tx_id"`
+	//投标时间，即交易时间
+	BidTime string `json:"bid_time"`
+	//投标状态
+	//有效：active 已修改：revised 已作废：disqualified
+	BidStatus string `json:"bid_status"`
+}
+
+//查询投标
+type ListBids struct {
+	//查询方用户代码，必须是合约发布方本人
+	UserCode string `json:"user_code"`
+	//合同代码
+	ContractCode string `json:"contract_code"`
+	//all：包含已修改的投标，默认只返回有效投标
+	BidType string `json:"bid_type"`
+}
+
+//保存投标
+func (a *BillChaincode) putBid(stub shim.ChaincodeStubInterface, bid Bid) bool {
+	key, err := stub.CreateCompositeKey("bid", []string{bid.ContractCode, bid.UserCode, bid.TxId})
+	if err != nil {
+		return false
+	}
+	b, err := json.Marshal(bid)
+	if err != nil {
+		return false
+	}
+	if err := stub.PutState(key, b); err != nil {
+		return false
+	}
+	//维护投标方的索引
+	if putUserIndex(stub, bid.UserCode, Contract_Role_Bidder, bid.ContractCode) != nil {
+		return false
+	}
+	return true
+}
+
+//取出合约的投标，userCode为空时取所有投标方的
+func (a *BillChaincode) getBids(stub shim.ChaincodeStubInterface, contractCode string, userCode string) ([]Bid, error) {
+	attrs := []string{contractCode}
+	if userCode != "" {
+		attrs = append(attrs, userCode)
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("bid", attrs)
+	if err != nil {
+		return nil, fmt.Errorf("查询投标失败")
+	}
+	defer resultsIterator.Close()
+
+	bids := make([]Bid, 0)
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("遍历投标失败")
+		}
+		var bid Bid
+		if err := json.Unmarshal(kv.Value, &bid); err != nil {
+			return nil, fmt.Errorf("投标解析失败")
+		}
+		bids = append(bids, bid)
+	}
+	return bids, nil
+}
+
+//把投标方之前的有效投标改为已修改
+func (a *BillChaincode) reviseBids(stub shim.ChaincodeStubInterface, contractCode string, userCode string) error {
+	bids, err := a.getBids(stub, contractCode, userCode)
+	if err != nil {
+		return err
+	}
+	for _, bid := range bids {
+		if bid.BidStatus != Bid_Status_Active {
+			continue
+		}
+		bid.BidStatus = Bid_Status_Revised
+		if !a.putBid(stub, bid) {
+			return fmt.Errorf("投标保存失败")
+		}
+	}
+	return nil
+}
+
+//查询投标，只有合约发布方可以查询
+func (a *BillChaincode) listBids(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//判断输入参数个数
+	if len(args) != 1 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
+	}
+
+	//解析
+	list_bids := &ListBids{}
+	err := json.Unmarshal([]byte(args[0]), list_bids)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "解析失败")
+	}
+
+	//判断合约是否存在
+	bill, bl := a.getBill(stub, list_bids.ContractCode)
+	if !bl {
+		return getErrorRet(stub, client.Code_Not_Found, "合约不存在")
+	}
+	//只有发布方可以查询
+	if list_bids.UserCode != bill.UserCode {
+		return getErrorRet(stub, client.Code_Permission_Denied, "只有合约发布方可以查询投标")
+	}
+	err = checkUserPermission(stub, list_bids.UserCode, User_Role_Publisher)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
+	}
+
+	bids, err := a.getBids(stub, list_bids.ContractCode, "")
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, err.Error())
+	}
+	list := make([]Bid, 0)
+	for _, bid := range bids {
+		if list_bids.BidType != "all" && bid.BidStatus != Bid_Status_Active {
+			continue
+		}
+		list = append(list, bid)
+	}
+
+	return getSuccessRet(stub, "", list)
+}
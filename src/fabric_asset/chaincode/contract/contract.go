@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/hex"
 	"encoding/json"
+	"fabric_asset/client"
 	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	pb "github.com/hyperledger/fabric/protos/peer"
@@ -10,8 +12,20 @@ import (
 //Invoke
 //发布合约
 //响应合约
+//揭标
 //合约成交
+//采购方确认成交
+//设置里程碑
+//合约开始履行
+//提交里程碑
+//验收里程碑
 //合约关闭
+//投标查询
+//上传附件
+//附件查询
+//附件校验
+//用户登记
+//用户查询
 //合约交易查询
 //合约交易历史数据查询
 
@@ -22,24 +36,48 @@ import (
 type Bill struct {
 	//合约id
 	TaskId string `json:"task_id"`
-	//用户代码
+	//发布方用户代码
 	UserCode string `json:"user_code"`
 	//合同代码
 	ContractCode string `json:"contract_code"`
 	//采购方用户代码
 	PurchaseUserCode string `json:"purchase_user_code"`
-	//投标开始时间
+	//发布时间，即发布的交易时间
+	CreateTime string `json:"create_time"`
+	//投标开始时间，格式为2006-01-02 15:04:05（UTC）
 	BidingStartTime string `json:"biding_start_time"`
-	//投标结束时间
+	//投标结束时间，格式同上，不包含该时刻
 	BidingEndTime string `json:"biding_end_time"`
-	//关闭时间
+	//投标方式
+	//公开投标：open 密封投标：sealed，默认公开投标
+	BidMode string `json:"bid_mode"`
+	//揭标结束时间，密封投标必填，不包含该时刻
+	RevealEndTime string `json:"reveal_end_time"`
+	//关闭时间，即关闭的交易时间
 	CloseTime string `json:"close_time"`
+	//关闭原因
+	CloseReason string `json:"close_reason"`
+	//关闭操作人，格式为 MSP ID/证书名
+	ClosedBy string `json:"closed_by"`
 	//合同开始时间
 	ContractStartTime string `json:"contract_start_time"`
 	//合同结束时间
 	ContractEndTime string `json:"contract_end_time"`
+	//中标方用户代码
+	WinnerUserCode string `json:"winner_user_code"`
+	//中标金额
+	DealAmount int `json:"deal_amount"`
+	//成交时间，即成交的交易时间
+	DealTime string `json:"deal_time"`
+	//采购方确认成交的时间
+	ConfirmTime string `json:"confirm_time"`
+	//履约里程碑
+	Milestones []Milestone `json:"milestones"`
+	//支付链码名，在当前通道上调用，为空时验收里程碑不付款
+	PaymentChaincode string `json:"payment_chaincode"`
 	//合同状态
-	//发布合同：yes 关闭合同：close 已提交：deal
+	//published：已发布 bidding：投标中 awarded：已成交 in_progress：履行中
+	//completed：已完成 cancelled：已取消 expired：已过期
 	ContractStatus string `json:"contract_status"`
 }
 
@@ -51,74 +89,82 @@ type BidingBill struct {
 	UserCode string `json:"user_code"`
 	//合同代码
 	ContractCode string `json:"contract_code"`
-	//合同状态
-	//发布合同：yes 关闭合同：close 已提交：deal
-	ContractStatus string `json:"contract_status"`
+	//投标金额，密封投标不填
+	Amount int `json:"amount"`
+	//投标条款
+	Terms string `json:"terms"`
+	//密封投标的承诺哈希，sha256(合同代码|投标方用户代码|金额|盐)的十六进制
+	Commitment string `json:"commitment"`
 }
 
 //合约成交
 type BillDeal struct {
 	//id
 	TaskId string `json:"task_id"`
-	//用户代码
+	//发布方用户代码
 	UserCode string `json:"user_code"`
 	//合同代码
 	ContractCode string `json:"contract_code"`
-	//成交时间
+	//中标方用户代码，必须有有效投标；密封投标不填，自动选择金额最低的有效投标
+	WinnerUserCode string `json:"winner_user_code"`
+	//成交时间，不再使用，成交时间取交易时间
 	DealTime string `json:"deal_time"`
-	//合同状态
-	//发布合同：yes 关闭合同：close 已提交：deal
-	ContractStatus string `json:"contract_status"`
+}
+
+//采购方确认成交
+type BillConfirm struct {
+	//采购方用户代码
+	UserCode string `json:"user_code"`
+	//合同代码
+	ContractCode string `json:"contract_code"`
+}
+
+//合约开始履行
+type BillStart struct {
+	//id
+	TaskId string `json:"task_id"`
+	//发布方用户代码
+	UserCode string `json:"user_code"`
+	//合同代码
+	ContractCode string `json:"contract_code"`
 }
 
 //用户合约关闭
 type BillClose struct {
 	//id
 	TaskId string `json:"task_id"`
-	//用户代码
+	//发布方用户代码
 	UserCode string `json:"user_code"`
 	//合同代码
 	ContractCode string `json:"contract_code"`
-	//结束时间
+	//结束时间，不再使用，关闭时间取交易时间
 	CloseTime string `json:"close_time"`
-	//合同状态
-	//发布合同：yes 关闭合同：close 已提交：deal
+	//关闭原因
+	Reason string `json:"reason"`
+	//关闭后的状态
+	//cancelled：取消 completed：完成 expired：过期
 	ContractStatus string `json:"contract_status"`
 }
 
-//链码的返回结构
-type chaincodeRet struct {
-	//1代表成功，0代表失败
-	Result int `json:"result"`
-	//0代表没有错误
-	//1000代表参数错误
-	//2000代表内容格式错误
-	ErrorCode int `json:"error_code"`
-	//错误信息
-	ErrorMsg string `json:"error_msg"`
-}
-
 //合约查询
 type QueryBill struct {
 	TaskId       string `json:"task_id"`
 	UserCode     string `json:"user_code"`
 	ContractCode string `json:"contract_code"`
 	//last：查询的是最新的合约交易，whole：查询的是全部的合约的交易信息
+	//list：查询用户参与的合约，按下面的条件过滤
 	VersionType string `json:"version_type"`
-}
-
-//定义用于返回查询结果的结构体
-type queryRet struct {
-	//1代表成功，0代表失败
-	Result int `json:"result"`
-	//0代表没有错误
-	//1000代表参数错误
-	//2000代表内容格式错误
-	ErrorCode int `json:"error_code"`
-	//错误信息
-	ErrorMsg string `json:"error_msg"`
-	//返回合同列表
-	DataList []Bill `json:"data_list"`
+	//用户在合约中的角色：publisher、purchaser、bidder，为空时不限
+	Role string `json:"role"`
+	//合约状态，为空时不限
+	ContractStatus string `json:"contract_status"`
+	//发布时间范围，格式同合约时间，为空时不限
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+	//页码，从0开始
+	Page int `json:"page"`
+	//每页条数
+	PageSize int `json:"page_size"`
 }
 
 //结构体
@@ -126,8 +172,27 @@ type BillChaincode struct {
 }
 
 //初始化
+//-c '{"Args":["init","管理员MSP(可选)"]}'
+//管理员负责登记用户，不传时为实例化链码的组织
 func (a *BillChaincode) Init(stub shim.ChaincodeStubInterface) pb.Response {
-	return shim.Success(nil)
+	_, args := stub.GetFunctionAndParameters()
+	if len(args) > 1 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数个数错误")
+	}
+	var admin string
+	if len(args) == 1 && args[0] != "" {
+		admin = args[0]
+	} else {
+		identity, err := getCreator(stub)
+		if err != nil {
+			return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
+		}
+		admin = identity.Mspid
+	}
+	if err := putAdmin(stub, admin); err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, err.Error())
+	}
+	return getSuccessRet(stub, "", nil)
 }
 
 //链码入口
@@ -141,56 +206,55 @@ func (a *BillChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	} else if function == "link_contract_biding" {
 		//响应合约
 		return a.LinkContractBiding(stub, args)
+	} else if function == "link_contract_reveal" {
+		//揭标
+		return a.LinkContractReveal(stub, args)
 	} else if function == "link_contract_deal" {
 		//合约成交
 		return a.LinkContractDeal(stub, args)
+	} else if function == "link_contract_confirm" {
+		//采购方确认成交
+		return a.LinkContractConfirm(stub, args)
+	} else if function == "set_milestones" {
+		//设置里程碑
+		return a.setMilestones(stub, args)
+	} else if function == "submit_milestone" {
+		//提交里程碑
+		return a.submitMilestone(stub, args)
+	} else if function == "review_milestone" {
+		//验收里程碑
+		return a.reviewMilestone(stub, args)
+	} else if function == "link_contract_start" {
+		//合约开始履行
+		return a.LinkContractStart(stub, args)
 	} else if function == "link_contract_close" {
 		//合约关闭
 		return a.LinkContractClose(stub, args)
+	} else if function == "list_bids" {
+		//投标查询
+		return a.listBids(stub, args)
+	} else if function == "attach_document" {
+		//上传附件
+		return a.attachDocument(stub, args)
+	} else if function == "list_documents" {
+		//附件查询
+		return a.listDocuments(stub, args)
+	} else if function == "verify_document" {
+		//附件校验
+		return a.verifyDocument(stub, args)
+	} else if function == "register_user" {
+		//用户登记
+		return a.registerUser(stub, args)
+	} else if function == "query_user" {
+		//用户查询
+		return a.queryUser(stub, args)
 	} else if function == "query" {
 		//合约查询
 		return a.query(stub, args)
 	} else {
 		//处理错误
-		res := getRetString(0, 1000, "无效的方法名")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Invalid_Argument, "无效的方法名")
 	}
-	return shim.Success(nil)
-}
-
-//根据传入的参数处理异常
-func getRetString(result int, code int, msg string) string {
-	var r chaincodeRet
-	//1代表成功，0代表失败
-	r.Result = result
-	//1000代表参数错误
-	r.ErrorCode = code
-	r.ErrorMsg = msg
-	//序列化
-	b, err := json.Marshal(r)
-	if err != nil {
-		fmt.Println("序列化失败")
-		return ""
-	}
-	//返回字符串
-	return string(b)
-}
-
-//根据传入的参数处理异常
-func getRetByte(result int, code int, msg string) []byte {
-	var r chaincodeRet
-	//1代表成功，0代表失败
-	r.Result = result
-	//1000代表参数错误
-	r.ErrorCode = code
-	r.ErrorMsg = msg
-	//序列化
-	b, err := json.Marshal(r)
-	if err != nil {
-		fmt.Println("序列化失败")
-		return nil
-	}
-	return b
 }
 
 //发布合约
@@ -198,8 +262,7 @@ func (a *BillChaincode) LinkContractCreate(stub shim.ChaincodeStubInterface, arg
 	//判断参数个数
 	if len(args) != 1 {
 		//处理错误
-		res := getRetString(0, 1000, "参数必须是一个")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
 	}
 
 	//将输入参数解析到结构体
@@ -208,22 +271,66 @@ func (a *BillChaincode) LinkContractCreate(stub shim.ChaincodeStubInterface, arg
 	err := json.Unmarshal(arg, &bill)
 	if err != nil {
 		//处理错误
-		res := getRetString(0, 2000, "合约解析失败")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Invalid_Content, "合约解析失败")
 	}
 	//如果合约代码为空则返回错误
 	if bill.ContractCode == "" {
 		//处理错误
-		res := getRetString(0, 2000, "合约代码不能为空")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Invalid_Content, "合约代码不能为空")
+	}
+	//发布方必须是提交者本人，采购方必须已登记
+	err = checkUserPermission(stub, bill.UserCode, User_Role_Publisher)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
+	}
+	if bill.PurchaseUserCode == "" {
+		return getErrorRet(stub, client.Code_Invalid_Content, "采购方用户代码不能为空")
+	}
+	err = checkUserRole(stub, bill.PurchaseUserCode, User_Role_Purchaser)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
+	}
+	//成交信息由后续操作填写
+	bill.WinnerUserCode = ""
+	bill.DealAmount = 0
+	bill.DealTime = ""
+	bill.ConfirmTime = ""
+	bill.CloseReason = ""
+	bill.ClosedBy = ""
+	//里程碑在成交后设置
+	bill.Milestones = nil
+	bill.PaymentChaincode = ""
+
+	//默认公开投标
+	if bill.BidMode == "" {
+		bill.BidMode = Bid_Mode_Open
+	}
+	if bill.BidMode != Bid_Mode_Open && bill.BidMode != Bid_Mode_Sealed {
+		return getErrorRet(stub, client.Code_Invalid_Content, "投标方式必须是open或sealed")
+	}
+
+	//校验时间格式
+	err = checkBillTimes(bill)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Invalid_Content, err.Error())
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, err.Error())
+	}
+	bill.CreateTime = txTime.Format(Time_Layout)
+	//新发布的合约状态固定为已发布
+	bill.ContractStatus = ""
+	err = transitBill(&bill, Contract_Status_Published)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Illegal_Transition, err.Error())
 	}
 	//进行校验，判断世界状态中合约是否已经存在
 	_, existbl := a.getBill(stub, bill.ContractCode)
 	//合约已经存在
 	if existbl {
 		//处理错误
-		res := getRetString(0, 2000, "合约已经存在")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Already_Exists, "合约已经存在")
 	}
 
 	//保存合约
@@ -231,14 +338,9 @@ func (a *BillChaincode) LinkContractCreate(stub shim.ChaincodeStubInterface, arg
 	if !bl {
 		//保存失败
 		//处理错误
-		res := getRetString(0, 2000, "合约保存失败")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Ledger_Error, "合约保存失败")
 	}
-
-	//打印合约信息
-	fmt.Println(bill)
-	res := getRetByte(1, 0, "发布合约成功")
-	return shim.Success(res)
+	return getSuccessRet(stub, "发布合约成功", bill)
 
 }
 
@@ -255,6 +357,10 @@ func (a *BillChaincode) getBill(stub shim.ChaincodeStubInterface, bill_No string
 	if err != nil {
 		return bill, false
 	}
+	//兼容旧版本的状态
+	if status, ok := legacyContractStatus[bill.ContractStatus]; ok {
+		bill.ContractStatus = status
+	}
 	//返回
 	return bill, true
 }
@@ -272,6 +378,13 @@ func (a *BillChaincode) putBill(stub shim.ChaincodeStubInterface, bill Bill) ([]
 	if err != nil {
 		return nil, false
 	}
+	//维护发布方和采购方的索引
+	if putUserIndex(stub, bill.UserCode, Contract_Role_Publisher, bill.ContractCode) != nil {
+		return nil, false
+	}
+	if putUserIndex(stub, bill.PurchaseUserCode, Contract_Role_Purchaser, bill.ContractCode) != nil {
+		return nil, false
+	}
 	return byte, true
 }
 
@@ -279,8 +392,7 @@ func (a *BillChaincode) putBill(stub shim.ChaincodeStubInterface, bill Bill) ([]
 func (a *BillChaincode) LinkContractBiding(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	//判断参数个数
 	if len(args) != 1 {
-		res := getRetString(0, 1000, "参数必须是一个")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
 	}
 
 	//解析
@@ -288,8 +400,7 @@ func (a *BillChaincode) LinkContractBiding(stub shim.ChaincodeStubInterface, arg
 	biding_bill := &BidingBill{}
 	err := json.Unmarshal(arg, biding_bill)
 	if err != nil {
-		res := getRetString(0, 2000, "json解析失败")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Invalid_Content, "json解析失败")
 	}
 
 	//判断合约是否存在
@@ -297,38 +408,76 @@ func (a *BillChaincode) LinkContractBiding(stub shim.ChaincodeStubInterface, arg
 	bill, bl := a.getBill(stub, key_id)
 	if !bl {
 		//没查到
-		res := getRetString(0, 2000, "合同代码不存在")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Not_Found, "合同代码不存在")
 	}
-	//判断合约是否已经成交，若成交，不能再响应
-	if bill.ContractStatus == "deal" {
-		res := getRetString(0, 2000, "合约已经成交")
-		return shim.Error(res)
-	} else if bill.ContractStatus == "close" {
-		res := getRetString(0, 2000, "合约已经关闭")
-		return shim.Error(res)
+	//判断合约状态是否允许响应
+	err = transitBill(&bill, Contract_Status_Bidding)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Illegal_Transition, err.Error())
+	}
+	//只能在投标时间内响应
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, err.Error())
+	}
+	if !inBidingWindow(bill, txTime) {
+		return getErrorRet(stub, client.Code_Out_Of_Window, "不在投标时间内")
 	}
-	fmt.Println(bill)
 
-	//保存
-	_, bl = a.putBill(stub, bill)
+	//投标方必须是登记的供应商本人
+	err = checkUserPermission(stub, biding_bill.UserCode, User_Role_Supplier)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
+	}
+	if biding_bill.UserCode == bill.UserCode {
+		return getErrorRet(stub, client.Code_Invalid_Content, "不能响应自己发布的合约")
+	}
+	//密封投标只提交承诺，公开投标提交金额
+	if bill.BidMode == Bid_Mode_Sealed {
+		if hash, err := hex.DecodeString(biding_bill.Commitment); err != nil || len(hash) != 32 {
+			return getErrorRet(stub, client.Code_Invalid_Content, "承诺必须是sha256的十六进制")
+		}
+		if biding_bill.Amount != 0 {
+			return getErrorRet(stub, client.Code_Invalid_Content, "密封投标不能提交金额")
+		}
+	} else if biding_bill.Amount <= 0 {
+		return getErrorRet(stub, client.Code_Invalid_Content, "投标金额必须大于0")
+	}
 
-	bill, bl = a.getBill(stub, key_id)
-	fmt.Println(bill)
+	//每个投标方只保留一条有效投标
+	err = a.reviseBids(stub, key_id, biding_bill.UserCode)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, err.Error())
+	}
+
+	//保存投标
+	bid := Bid{
+		TaskId:       biding_bill.TaskId,
+		UserCode:     biding_bill.UserCode,
+		ContractCode: key_id,
+		Amount:       biding_bill.Amount,
+		Terms:        biding_bill.Terms,
+		Commitment:   biding_bill.Commitment,
+		TxId:         stub.GetTxID(),
+		BidTime:      txTime.Format(Time_Layout),
+		BidStatus:    Bid_Status_Active,
+	}
+	if !a.putBid(stub, bid) {
+		return getErrorRet(stub, client.Code_Ledger_Error, "投标保存失败")
+	}
+	//第一条投标后合约变为投标中
+	_, bl = a.putBill(stub, bill)
 	if !bl {
-		res := getRetString(0, 2000, "合约保存失败")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Ledger_Error, "合约保存失败")
 	}
-	res := getRetByte(1, 0, "响应成功")
-	return shim.Success(res)
+	return getSuccessRet(stub, "响应成功", bid)
 }
 
 //合约成交
 func (a *BillChaincode) LinkContractDeal(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	//判断输入参数个数
 	if len(args) != 1 {
-		res := getRetString(0, 1000, "参数必须是一个")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
 	}
 
 	//解析
@@ -336,44 +485,173 @@ func (a *BillChaincode) LinkContractDeal(stub shim.ChaincodeStubInterface, args
 	billdeal := &BillDeal{}
 	err := json.Unmarshal(arg, billdeal)
 	if err != nil {
-		res := getRetString(0, 1000, "解析失败")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Invalid_Argument, "解析失败")
 	}
 
 	//判断合约是否存在
 	bill, existbl := a.getBill(stub, billdeal.ContractCode)
 	if !existbl {
-		res := getRetString(0, 1000, "合约不存在")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Not_Found, "合约不存在")
+	}
+	//只有发布方可以成交
+	if billdeal.UserCode != bill.UserCode {
+		return getErrorRet(stub, client.Code_Permission_Denied, "只有合约发布方可以成交")
 	}
-	//判断合约是否已经关闭或成交
-	if bill.ContractStatus == "deal" {
-		res := getRetString(0, 2000, "合约已经成交")
-		return shim.Error(res)
-	} else if bill.ContractStatus == "close" {
-		res := getRetString(0, 2000, "合约已经关闭")
-		return shim.Error(res)
+	err = checkUserPermission(stub, billdeal.UserCode, User_Role_Publisher)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
+	}
+	//判断合约状态是否允许成交
+	err = checkTransition(bill.ContractStatus, Contract_Status_Awarded)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Illegal_Transition, err.Error())
+	}
+	//投标结束后才能成交
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, err.Error())
+	}
+	if !bidingClosed(bill, txTime) {
+		return getErrorRet(stub, client.Code_Out_Of_Window, "投标尚未结束")
+	}
+
+	var winning *Bid
+	if bill.BidMode == Bid_Mode_Sealed {
+		//密封投标在揭标结束后自动选择中标方
+		if !revealClosed(bill, txTime) {
+			return getErrorRet(stub, client.Code_Out_Of_Window, "揭标尚未结束")
+		}
+		winning, err = a.pickSealedWinner(stub, bill)
+		if err != nil {
+			return getErrorRet(stub, client.Code_Ledger_Error, err.Error())
+		}
+		if winning == nil {
+			return getErrorRet(stub, client.Code_Not_Found, "没有有效的揭标")
+		}
+	} else {
+		//中标方必须有有效投标
+		bids, err := a.getBids(stub, bill.ContractCode, billdeal.WinnerUserCode)
+		if err != nil {
+			return getErrorRet(stub, client.Code_Ledger_Error, err.Error())
+		}
+		for i := range bids {
+			if bids[i].BidStatus == Bid_Status_Active {
+				winning = &bids[i]
+				break
+			}
+		}
+		if billdeal.WinnerUserCode == "" || winning == nil {
+			return getErrorRet(stub, client.Code_Not_Found, "中标方没有有效投标")
+		}
 	}
 
 	//修改合约状态
-	bill.ContractStatus = "deal"
+	bill.ContractStatus = Contract_Status_Awarded
+	bill.WinnerUserCode = winning.UserCode
+	bill.DealAmount = winning.Amount
+	bill.DealTime = txTime.Format(Time_Layout)
 	//保存合约
 	_, bl := a.putBill(stub, bill)
 	if !bl {
-		res := getRetString(0, 2000, "合约保存失败")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Ledger_Error, "合约保存失败")
+	}
+	return getSuccessRet(stub, "合约成交成功", bill)
+}
+
+//采购方确认成交，确认后才能开始履行
+func (a *BillChaincode) LinkContractConfirm(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//判断输入参数个数
+	if len(args) != 1 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
+	}
+
+	//解析
+	billconfirm := &BillConfirm{}
+	err := json.Unmarshal([]byte(args[0]), billconfirm)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "解析失败")
+	}
+
+	//判断合约是否存在
+	bill, existbl := a.getBill(stub, billconfirm.ContractCode)
+	if !existbl {
+		return getErrorRet(stub, client.Code_Not_Found, "合约不存在")
+	}
+	//只有采购方可以确认
+	if billconfirm.UserCode != bill.PurchaseUserCode {
+		return getErrorRet(stub, client.Code_Permission_Denied, "只有采购方可以确认成交")
+	}
+	err = checkUserPermission(stub, billconfirm.UserCode, User_Role_Purchaser)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
+	}
+	if bill.ContractStatus != Contract_Status_Awarded {
+		return getErrorRet(stub, client.Code_Illegal_Transition, fmt.Sprintf("合约状态为%s，不能确认成交", contractStatusNames[bill.ContractStatus]))
+	}
+	if bill.ConfirmTime != "" {
+		return getErrorRet(stub, client.Code_Already_Exists, "合约已经确认成交")
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, err.Error())
+	}
+	bill.ConfirmTime = txTime.Format(Time_Layout)
+	_, bl := a.putBill(stub, bill)
+	if !bl {
+		return getErrorRet(stub, client.Code_Ledger_Error, "合约保存失败")
+	}
+	return getSuccessRet(stub, "确认成交成功", bill)
+}
+
+//合约开始履行
+func (a *BillChaincode) LinkContractStart(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//判断输入参数个数
+	if len(args) != 1 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
+	}
+
+	//解析
+	billstart := &BillStart{}
+	err := json.Unmarshal([]byte(args[0]), billstart)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "解析失败")
+	}
+
+	//判断合约是否存在
+	bill, existbl := a.getBill(stub, billstart.ContractCode)
+	if !existbl {
+		return getErrorRet(stub, client.Code_Not_Found, "合约不存在")
+	}
+	//只有发布方可以开始履行
+	if billstart.UserCode != bill.UserCode {
+		return getErrorRet(stub, client.Code_Permission_Denied, "只有合约发布方可以开始履行")
+	}
+	err = checkUserPermission(stub, billstart.UserCode, User_Role_Publisher)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
+	}
+	//需要采购方确认成交
+	if bill.ContractStatus == Contract_Status_Awarded && bill.ConfirmTime == "" {
+		return getErrorRet(stub, client.Code_Illegal_Transition, "采购方尚未确认成交")
+	}
+	//修改合约状态
+	err = transitBill(&bill, Contract_Status_InProgress)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Illegal_Transition, err.Error())
+	}
+	_, bl := a.putBill(stub, bill)
+	if !bl {
+		return getErrorRet(stub, client.Code_Ledger_Error, "合约保存失败")
 	}
-	fmt.Println(bill)
-	res := getRetByte(1, 0, "合约成交成功")
-	return shim.Success(res)
+	return getSuccessRet(stub, "合约开始履行", bill)
 }
 
 //合约关闭
 func (a *BillChaincode) LinkContractClose(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	//判断输入参数个数
 	if len(args) != 1 {
-		res := getRetString(0, 1000, "参数必须是一个")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
 	}
 
 	//解析
@@ -381,42 +659,68 @@ func (a *BillChaincode) LinkContractClose(stub shim.ChaincodeStubInterface, args
 	billclose := &BillClose{}
 	err := json.Unmarshal(arg, billclose)
 	if err != nil {
-		res := getRetString(0, 1000, "解析失败")
-		return shim.Error(res)
-	}
-
-	//合约关闭
-	stub.PutState(billclose.ContractCode, arg)
-	if err != nil {
-		return shim.Error("合约关闭失败")
+		return getErrorRet(stub, client.Code_Invalid_Argument, "解析失败")
 	}
 
 	//查找合约是否存在
 	bill, exitbl := a.getBill(stub, billclose.ContractCode)
 	if !exitbl {
-		res := getRetString(0, 1000, "合约关闭失败，合约不存在")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Not_Found, "合约关闭失败，合约不存在")
+	}
+	//只有发布方可以关闭
+	if billclose.UserCode != bill.UserCode {
+		return getErrorRet(stub, client.Code_Permission_Denied, "只有合约发布方可以关闭")
+	}
+	err = checkUserPermission(stub, billclose.UserCode, User_Role_Publisher)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
+	}
+
+	//只能关闭为取消、完成或过期
+	if billclose.ContractStatus != Contract_Status_Cancelled && billclose.ContractStatus != Contract_Status_Completed && billclose.ContractStatus != Contract_Status_Expired {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "关闭状态必须是cancelled、completed或expired")
+	}
+	if billclose.Reason == "" {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "关闭原因不能为空")
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, err.Error())
+	}
+	//有里程碑的合约在全部验收后自动完成
+	if billclose.ContractStatus == Contract_Status_Completed && len(bill.Milestones) > 0 {
+		return getErrorRet(stub, client.Code_Illegal_Transition, "合约有里程碑，全部验收后自动完成")
+	}
+	//投标结束后才能过期
+	if billclose.ContractStatus == Contract_Status_Expired && !bidingClosed(bill, txTime) {
+		return getErrorRet(stub, client.Code_Out_Of_Window, "投标尚未结束，不能过期")
+	}
+	closedBy, err := getCreatorIdentity(stub)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
 	}
 
-	//更改合约状态和时间
-	bill.ContractStatus = billclose.ContractStatus
-	bill.CloseTime = billclose.CloseTime
+	//更改合约状态，其余字段保持不变
+	err = transitBill(&bill, billclose.ContractStatus)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Illegal_Transition, err.Error())
+	}
+	bill.CloseTime = txTime.Format(Time_Layout)
+	bill.CloseReason = billclose.Reason
+	bill.ClosedBy = closedBy
 	_, bl := a.putBill(stub, bill)
 	if !bl {
-		res := getRetString(0, 1000, "合约关闭失败")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Ledger_Error, "合约关闭失败")
 	}
-	res := getRetByte(1, 0, "合约成交成功")
-	return shim.Success(res)
+	return getSuccessRet(stub, fmt.Sprintf("合约关闭成功，状态为%s", contractStatusNames[bill.ContractStatus]), bill)
 }
 
 //查询合约
-//支持查询最新的和查询所有的
+//支持查询最新的、查询所有的和查询用户参与的，都要求提交者是查询的用户本人
 func (a *BillChaincode) query(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	//判断输入参数个数
 	if len(args) != 1 {
-		res := getRetString(0, 1000, "参数必须是一个")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
 	}
 
 	//解析
@@ -424,15 +728,25 @@ func (a *BillChaincode) query(stub shim.ChaincodeStubInterface, args []string) p
 	query_bill := &QueryBill{}
 	err := json.Unmarshal(arg, query_bill)
 	if err != nil {
-		res := getRetString(0, 1000, "解析失败")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Invalid_Argument, "解析失败")
+	}
+	//只有用户本人可以查询
+	if query_bill.UserCode == "" {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "用户代码不能为空")
+	}
+	err = checkUserIdentity(stub, query_bill.UserCode)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
 	}
-	fmt.Println(query_bill)
 
 	if query_bill.VersionType == "last" {
 		//查询最新的合约信息
 		return a.queryLastBill(stub, query_bill.UserCode, query_bill.ContractCode)
 
+	} else if query_bill.VersionType == "list" {
+		//查询用户参与的合约
+		return a.queryUserBills(stub, query_bill)
+
 	} else {
 		//查询所有合约信息
 		return a.queryWholeBill(stub, query_bill.UserCode, query_bill.ContractCode)
@@ -440,73 +754,21 @@ func (a *BillChaincode) query(stub shim.ChaincodeStubInterface, args []string) p
 
 }
 
-//查询最新合约信息
+//查询最新合约信息，只有参与合约的用户可以查询
 func (a *BillChaincode) queryLastBill(stub shim.ChaincodeStubInterface, userCode string, contractCode string) pb.Response {
 	key_id := contractCode
 	//查询合约
 	bill, bl := a.getBill(stub, key_id)
 	if !bl {
-		res := getRetString(0, 1000, "查询失败")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Not_Found, "查询失败")
 	}
-
-	var history []Bill
-	var hist = bill
-	history = append(history, hist)
-	res := getQueryByte(1, 0, "", history)
-	return shim.Success(res)
-}
-
-//查询所有合约信息
-func (a *BillChaincode) queryWholeBill(stub shim.ChaincodeStubInterface, userCode string, contractCode string) pb.Response {
-	key_id := contractCode
-	//查询合约——fabric的API查询历史
-	resultsIterator, err := stub.GetHistoryForKey(key_id)
+	err := checkContractParticipant(stub, userCode, key_id)
 	if err != nil {
-		res := getRetString(0, 1000, "查询合约历史失败")
-		return shim.Error(res)
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
 	}
-	defer resultsIterator.Close()
-
-	var history []Bill
-	//循环遍历
-	for resultsIterator.HasNext() {
-		historyData, err := resultsIterator.Next()
-		if err != nil {
-			res := getRetString(0, 1000, "遍历合约历史失败")
-			return shim.Error(res)
-		}
 
-		var hist Bill
-		if historyData.Value == nil {
-			var emptyBill Bill
-			hist = emptyBill
-		} else {
-			json.Unmarshal(historyData.Value, &hist)
-			fmt.Println(hist)
-		}
-		history = append(history, hist)
-		fmt.Println(history)
-	}
-	res := getQueryByte(1, 0, "", history)
-	return shim.Success(res)
-
-}
-
-//根据传的状态码，返回查询的字节数组
-func getQueryByte(result int, code int, msg string, hist []Bill) []byte {
-	var r queryRet
-	//组装数据
-	r.Result = result
-	r.ErrorCode = code
-	r.ErrorMsg = msg
-	r.DataList = hist
-	b, err := json.Marshal(r)
-	if err != nil {
-		fmt.Println("序列化失败")
-		return nil
-	}
-	return b
+	history := []Bill{bill}
+	return getSuccessRet(stub, "", history)
 }
 
 func main() {
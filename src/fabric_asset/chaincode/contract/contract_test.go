@@ -0,0 +1,347 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fabric_asset/client"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	mspprotos "github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"math/big"
+	"testing"
+	"time"
+)
+
+//测试用的stub
+//MockStub取不到提交者身份、交易时间和transient，由testStub补上，再直接调用链码
+type testStub struct {
+	*shim.MockStub
+	t         *testing.T
+	cc        *BillChaincode
+	args      [][]byte
+	creator   []byte
+	transient map[string][]byte
+	txTime    time.Time
+	txCount   int
+}
+
+//测试中解析返回结构，data保留原始json
+type testRet struct {
+	Result  int             `json:"result"`
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+//测试用户，证书身份为 Org1MSP/用户代码
+const testMSP = "Org1MSP"
+
+//初始化链码并登记发布方pub、采购方buyer和供应商s1到s5
+func newTestStub(t *testing.T) *testStub {
+	cc := new(BillChaincode)
+	s := &testStub{
+		MockStub: shim.NewMockStub("contract", cc),
+		t:        t,
+		cc:       cc,
+	}
+	s.at("2018-06-01 00:00:00")
+	s.creator = newCreator(t, "AdminMSP", "admin")
+	if res := s.call(true, "init", "AdminMSP"); res.Status != shim.OK {
+		t.Fatalf("初始化失败：%s", res.Message)
+	}
+	s.register("pub", User_Role_Publisher)
+	s.register("buyer", User_Role_Purchaser)
+	for i := 1; i <= 5; i++ {
+		s.register(fmt.Sprintf("s%d", i), User_Role_Supplier)
+	}
+	return s
+}
+
+func (s *testStub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *testStub) GetStringArgs() []string {
+	args := make([]string, 0, len(s.args))
+	for _, arg := range s.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+func (s *testStub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+func (s *testStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func (s *testStub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+func (s *testStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: s.txTime.Unix(), Nanos: int32(s.txTime.Nanosecond())}, nil
+}
+
+//设置之后交易的时间
+func (s *testStub) at(value string) *testStub {
+	t, err := parseBillTime(value)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.txTime = t
+	return s
+}
+
+//以登记的用户身份提交
+func (s *testStub) as(userCode string) *testStub {
+	s.creator = newCreator(s.t, testMSP, userCode)
+	return s
+}
+
+//设置之后交易的transient，传nil清除
+func (s *testStub) withTransient(transient map[string][]byte) *testStub {
+	s.transient = transient
+	return s
+}
+
+//以管理员身份登记用户
+func (s *testStub) register(userCode string, role string) {
+	creator := s.creator
+	s.creator = newCreator(s.t, "AdminMSP", "admin")
+	s.mustInvoke(nil, "register_user", toJSON(s.t, User{
+		UserCode: userCode,
+		Identity: testMSP + "/" + userCode,
+		Roles:    []string{role},
+	}))
+	s.creator = creator
+}
+
+//执行一笔交易，交易id按顺序编号
+func (s *testStub) call(init bool, args ...string) pb.Response {
+	s.txCount++
+	txID := fmt.Sprintf("tx%04d", s.txCount)
+	s.args = make([][]byte, 0, len(args))
+	for _, arg := range args {
+		s.args = append(s.args, []byte(arg))
+	}
+	s.MockTransactionStart(txID)
+	defer s.MockTransactionEnd(txID)
+	if init {
+		return s.cc.Init(s)
+	}
+	return s.cc.Invoke(s)
+}
+
+//执行交易并解析返回结构
+func (s *testStub) invoke(args ...string) testRet {
+	res := s.call(false, args...)
+	var ret testRet
+	if err := json.Unmarshal(res.Payload, &ret); err != nil {
+		s.t.Fatalf("%s 的返回结构解析失败：%s", args[0], res.Payload)
+	}
+	if (res.Status == shim.OK) != (ret.Result == 1) {
+		s.t.Fatalf("%s 的状态%d与返回结构%+v不一致", args[0], res.Status, ret)
+	}
+	//失败时错误信息为纯文本
+	if res.Status != shim.OK && res.Message != ret.Message {
+		s.t.Fatalf("%s 的错误信息%q与返回结构不一致", args[0], res.Message)
+	}
+	return ret
+}
+
+//执行交易并要求成功，data不为nil时解析返回的数据
+func (s *testStub) mustInvoke(data interface{}, args ...string) testRet {
+	ret := s.invoke(args...)
+	if ret.Result != 1 {
+		s.t.Fatalf("%s 执行失败：%d %s", args[0], ret.Code, ret.Message)
+	}
+	if data != nil {
+		if err := json.Unmarshal(ret.Data, data); err != nil {
+			s.t.Fatalf("%s 的返回数据解析失败：%s", args[0], ret.Data)
+		}
+	}
+	return ret
+}
+
+//执行交易并要求返回该错误码
+func (s *testStub) expectCode(code int, args ...string) {
+	ret := s.invoke(args...)
+	if ret.Code != code {
+		s.t.Errorf("%s 的错误码为%d（%s），应为%d", args[0], ret.Code, ret.Message, code)
+	}
+}
+
+//发布合约，投标时间为6月1日到6月10日，密封投标的揭标结束时间为6月15日
+func (s *testStub) createBill(contractCode string, bidMode string) Bill {
+	bill := Bill{
+		UserCode:         "pub",
+		ContractCode:     contractCode,
+		PurchaseUserCode: "buyer",
+		BidingStartTime:  "2018-06-01 00:00:00",
+		BidingEndTime:    "2018-06-10 00:00:00",
+		BidMode:          bidMode,
+	}
+	if bidMode == Bid_Mode_Sealed {
+		bill.RevealEndTime = "2018-06-15 00:00:00"
+	}
+	s.as("pub").mustInvoke(&bill, "link_contract_create", toJSON(s.t, bill))
+	return bill
+}
+
+//公开投标
+func (s *testStub) bid(contractCode string, userCode string, amount int) Bid {
+	var bid Bid
+	s.as(userCode).mustInvoke(&bid, "link_contract_biding", toJSON(s.t, BidingBill{
+		UserCode:     userCode,
+		ContractCode: contractCode,
+		Amount:       amount,
+	}))
+	return bid
+}
+
+//查询合约的投标
+func (s *testStub) listBids(contractCode string, bidType string) []Bid {
+	var bids []Bid
+	s.as("pub").mustInvoke(&bids, "list_bids", toJSON(s.t, ListBids{
+		UserCode:     "pub",
+		ContractCode: contractCode,
+		BidType:      bidType,
+	}))
+	return bids
+}
+
+//查询最新的合约
+func (s *testStub) lastBill(contractCode string) Bill {
+	var bills []Bill
+	s.as("pub").mustInvoke(&bills, "query", toJSON(s.t, QueryBill{
+		UserCode:     "pub",
+		ContractCode: contractCode,
+		VersionType:  "last",
+	}))
+	if len(bills) != 1 {
+		s.t.Fatalf("查询合约%s失败", contractCode)
+	}
+	return bills[0]
+}
+
+func toJSON(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+//生成自签名证书，序列化为提交者身份
+func newCreator(t *testing.T, mspID string, commonName string) []byte {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2028, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	creator, err := proto.Marshal(&mspprotos.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return creator
+}
+
+func TestBidRevision(t *testing.T) {
+	s := newTestStub(t)
+	s.createBill("C1", Bid_Mode_Open)
+
+	s.at("2018-06-02 00:00:00")
+	first := s.bid("C1", "s1", 100)
+	s.bid("C1", "s2", 95)
+	s.at("2018-06-03 00:00:00")
+	second := s.bid("C1", "s1", 90)
+	if first.BidStatus != Bid_Status_Active || second.BidStatus != Bid_Status_Active {
+		t.Fatalf("新投标应为有效：%+v %+v", first, second)
+	}
+
+	//每个投标方只保留最后一条有效投标
+	active := s.listBids("C1", "")
+	if len(active) != 2 {
+		t.Fatalf("有效投标为%d条，应为2条：%+v", len(active), active)
+	}
+	for _, bid := range active {
+		if bid.UserCode == "s1" && (bid.TxId != second.TxId || bid.Amount != 90) {
+			t.Errorf("s1的有效投标应为修改后的投标：%+v", bid)
+		}
+	}
+	all := s.listBids("C1", "all")
+	if len(all) != 3 {
+		t.Fatalf("全部投标为%d条，应为3条：%+v", len(all), all)
+	}
+	for _, bid := range all {
+		if bid.TxId == first.TxId && bid.BidStatus != Bid_Status_Revised {
+			t.Errorf("被替代的投标应为已修改：%+v", bid)
+		}
+	}
+
+	//成交金额取修改后的投标
+	s.at("2018-06-10 00:00:00")
+	var bill Bill
+	s.as("pub").mustInvoke(&bill, "link_contract_deal", toJSON(t, BillDeal{
+		UserCode:       "pub",
+		ContractCode:   "C1",
+		WinnerUserCode: "s1",
+	}))
+	if bill.WinnerUserCode != "s1" || bill.DealAmount != 90 {
+		t.Errorf("成交结果错误：%+v", bill)
+	}
+}
+
+func TestBidRequiresSupplier(t *testing.T) {
+	s := newTestStub(t)
+	s.createBill("C1", Bid_Mode_Open)
+	s.at("2018-06-02 00:00:00")
+
+	//冒用别人的用户代码
+	s.as("s2").expectCode(client.Code_Permission_Denied, "link_contract_biding", toJSON(t, BidingBill{
+		UserCode:     "s1",
+		ContractCode: "C1",
+		Amount:       100,
+	}))
+	//不是供应商
+	s.as("buyer").expectCode(client.Code_Permission_Denied, "link_contract_biding", toJSON(t, BidingBill{
+		UserCode:     "buyer",
+		ContractCode: "C1",
+		Amount:       100,
+	}))
+	s.as("s1").expectCode(client.Code_Invalid_Content, "link_contract_biding", toJSON(t, BidingBill{
+		UserCode:     "s1",
+		ContractCode: "C1",
+		Amount:       0,
+	}))
+	if bids := s.listBids("C1", "all"); len(bids) != 0 {
+		t.Errorf("被拒绝的投标不应保存：%+v", bids)
+	}
+}
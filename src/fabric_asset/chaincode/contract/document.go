@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fabric_asset/client"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"strings"
+)
+
+//合约附件
+//文件本身存放在链下，链上只记录名字、sha256、大小、存储地址和上传人
+//key为document~合同代码~文件名，投标开始后同名附件不能覆盖，成交后附件不能再修改
+
+//附件
+type Document struct {
+	//合同代码
+	ContractCode string `json:"contract_code"`
+	//文件名，同一合约中唯一，投标开始前重复上传时覆盖
+	Name string `json:"name"`
+	//文件的sha256，小写十六进制
+	Sha256 string `json:"sha256"`
+	//文件大小，单位为字节
+	Size int64 `json:"size"`
+	//存储地址
+	Uri string `json:"uri"`
+	//上传人用户代码，必须是发布方或采购方
+	UserCode string `json:"user_code"`
+	//上传的交易id
+	TxId string `json:"tx_id"`
+	//上传时间，即交易时间
+	UploadTime string `json:"upload_time"`
+}
+
+//附件校验
+type VerifyDocument struct {
+	//合同代码
+	ContractCode string `json:"contract_code"`
+	//文件名
+	Name string `json:"name"`
+	//待校验文件的sha256
+	Sha256 string `json:"sha256"`
+}
+
+//附件校验结果
+type documentVerify struct {
+	//是否一致
+	Matched bool `json:"matched"`
+	//记录的附件
+	Document Document `json:"document"`
+}
+
+//附件的key
+func constructDocumentKey(stub shim.ChaincodeStubInterface, contractCode string, name string) (string, error) {
+	return stub.CreateCompositeKey("document", []string{contractCode, name})
+}
+
+//查询附件
+func getDocument(stub shim.ChaincodeStubInterface, contractCode string, name string) (Document, bool) {
+	var doc Document
+	key, err := constructDocumentKey(stub, contractCode, name)
+	if err != nil {
+		return doc, false
+	}
+	b, err := stub.GetState(key)
+	if err != nil || b == nil {
+		return doc, false
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return doc, false
+	}
+	return doc, true
+}
+
+//上传附件，成交前由发布方或采购方上传
+//投标开始后只能上传新文件，不能覆盖投标方已经看到的附件
+func (a *BillChaincode) attachDocument(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//判断输入参数个数
+	if len(args) != 1 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
+	}
+
+	//解析
+	doc := Document{}
+	err := json.Unmarshal([]byte(args[0]), &doc)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Invalid_Content, "解析失败")
+	}
+	if doc.Name == "" || doc.Uri == "" {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "文件名和存储地址不能为空")
+	}
+	if doc.Size <= 0 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "文件大小必须大于0")
+	}
+	doc.Sha256 = strings.ToLower(doc.Sha256)
+	if hash, err := hex.DecodeString(doc.Sha256); err != nil || len(hash) != 32 {
+		return getErrorRet(stub, client.Code_Invalid_Content, "文件哈希必须是sha256的十六进制")
+	}
+
+	//判断合约是否存在
+	bill, bl := a.getBill(stub, doc.ContractCode)
+	if !bl {
+		return getErrorRet(stub, client.Code_Not_Found, "合约不存在")
+	}
+	//成交后附件冻结
+	if bill.ContractStatus != Contract_Status_Published && bill.ContractStatus != Contract_Status_Bidding {
+		return getErrorRet(stub, client.Code_Illegal_Transition, fmt.Sprintf("合约状态为%s，附件已冻结", contractStatusNames[bill.ContractStatus]))
+	}
+	//只有发布方和采购方可以上传
+	if doc.UserCode != bill.UserCode && doc.UserCode != bill.PurchaseUserCode {
+		return getErrorRet(stub, client.Code_Permission_Denied, "只有合约发布方和采购方可以上传附件")
+	}
+	err = checkUserIdentity(stub, doc.UserCode)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, err.Error())
+	}
+	if _, exist := getDocument(stub, doc.ContractCode, doc.Name); exist {
+		bidingStart, err := parseBillTime(bill.BidingStartTime)
+		if bill.ContractStatus != Contract_Status_Published || err != nil || !txTime.Before(bidingStart) {
+			return getErrorRet(stub, client.Code_Already_Exists, "投标已经开始，不能覆盖同名附件")
+		}
+	}
+	doc.TxId = stub.GetTxID()
+	doc.UploadTime = txTime.Format(Time_Layout)
+
+	//保存
+	key, err := constructDocumentKey(stub, doc.ContractCode, doc.Name)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, "创建key失败")
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, "序列化失败")
+	}
+	if err := stub.PutState(key, b); err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, "附件保存失败")
+	}
+	return getSuccessRet(stub, "上传附件成功", doc)
+}
+
+//查询合约的附件，按文件名排序
+func (a *BillChaincode) listDocuments(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//判断输入参数个数
+	if len(args) != 1 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
+	}
+	if _, bl := a.getBill(stub, args[0]); !bl {
+		return getErrorRet(stub, client.Code_Not_Found, "合约不存在")
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("document", []string{args[0]})
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, "查询附件失败")
+	}
+	defer resultsIterator.Close()
+
+	docs := make([]Document, 0)
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return getErrorRet(stub, client.Code_Ledger_Error, "遍历附件失败")
+		}
+		var doc Document
+		if err := json.Unmarshal(kv.Value, &doc); err != nil {
+			return getErrorRet(stub, client.Code_Invalid_Content, "附件解析失败")
+		}
+		docs = append(docs, doc)
+	}
+	return getSuccessRet(stub, "", docs)
+}
+
+//校验文件的sha256是否与记录的一致，不一致时也返回成功，由matched表示结果
+func (a *BillChaincode) verifyDocument(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//判断输入参数个数
+	if len(args) != 1 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
+	}
+
+	//解析
+	verify := VerifyDocument{}
+	err := json.Unmarshal([]byte(args[0]), &verify)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Invalid_Content, "解析失败")
+	}
+	doc, ok := getDocument(stub, verify.ContractCode, verify.Name)
+	if !ok {
+		return getErrorRet(stub, client.Code_Not_Found, "附件不存在")
+	}
+
+	result := documentVerify{
+		Matched:  strings.ToLower(verify.Sha256) == doc.Sha256,
+		Document: doc,
+	}
+	if !result.Matched {
+		return getSuccessRet(stub, "文件与记录不一致", result)
+	}
+	return getSuccessRet(stub, "文件与记录一致", result)
+}
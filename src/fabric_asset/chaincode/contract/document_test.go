@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fabric_asset/client"
+	"testing"
+)
+
+//上传附件的参数
+func documentArg(t *testing.T, userCode string, name string, content string) string {
+	return toJSON(t, Document{
+		ContractCode: "C1",
+		Name:         name,
+		Sha256:       hex.EncodeToString(sha256Sum(content)),
+		Size:         int64(len(content)),
+		Uri:          "https://files.example.com/C1/" + name,
+		UserCode:     userCode,
+	})
+}
+
+func TestDocumentOverwriteBeforeBiding(t *testing.T) {
+	s := newTestStub(t)
+	s.at("2018-05-20 00:00:00")
+	s.createBill("C1", Bid_Mode_Open)
+
+	//投标开始前可以覆盖
+	s.as("pub").mustInvoke(nil, "attach_document", documentArg(t, "pub", "spec.pdf", "v1"))
+	s.as("buyer").mustInvoke(nil, "attach_document", documentArg(t, "buyer", "spec.pdf", "v2"))
+
+	var docs []Document
+	s.mustInvoke(&docs, "list_documents", "C1")
+	if len(docs) != 1 || docs[0].UserCode != "buyer" {
+		t.Errorf("附件应被覆盖：%+v", docs)
+	}
+}
+
+func TestDocumentFrozenAfterBidingStarts(t *testing.T) {
+	s := newTestStub(t)
+	s.at("2018-05-20 00:00:00")
+	s.createBill("C1", Bid_Mode_Open)
+	s.as("pub").mustInvoke(nil, "attach_document", documentArg(t, "pub", "spec.pdf", "v1"))
+
+	//投标时间开始后，即使还没有投标也不能覆盖
+	s.at("2018-06-01 00:00:00")
+	s.as("pub").expectCode(client.Code_Already_Exists, "attach_document", documentArg(t, "pub", "spec.pdf", "v2"))
+	//可以上传新文件
+	s.as("pub").mustInvoke(nil, "attach_document", documentArg(t, "pub", "faq.pdf", "faq"))
+
+	s.at("2018-06-02 00:00:00")
+	s.bid("C1", "s1", 100)
+	s.as("buyer").expectCode(client.Code_Already_Exists, "attach_document", documentArg(t, "buyer", "spec.pdf", "v3"))
+
+	//记录的仍是第一次上传的文件
+	var result documentVerify
+	s.mustInvoke(&result, "verify_document", toJSON(t, VerifyDocument{
+		ContractCode: "C1",
+		Name:         "spec.pdf",
+		Sha256:       hex.EncodeToString(sha256Sum("v1")),
+	}))
+	if !result.Matched {
+		t.Errorf("投标方看到的附件被修改：%+v", result.Document)
+	}
+
+	//成交后不能再上传
+	s.at("2018-06-10 00:00:00")
+	s.as("pub").mustInvoke(nil, "link_contract_deal", toJSON(t, BillDeal{UserCode: "pub", ContractCode: "C1", WinnerUserCode: "s1"}))
+	s.as("pub").expectCode(client.Code_Illegal_Transition, "attach_document", documentArg(t, "pub", "new.pdf", "new"))
+}
+
+func sha256Sum(content string) []byte {
+	sum := sha256.Sum256([]byte(content))
+	return sum[:]
+}
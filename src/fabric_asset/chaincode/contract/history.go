@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fabric_asset/client"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"sort"
+	"time"
+)
+
+//合约历史版本
+//每个版本带交易id、时间和删除标记，并列出相对上一个版本变化的字段
+
+//合约的一个历史版本
+type BillVersion struct {
+	//交易id
+	TxId string `json:"tx_id"`
+	//交易时间
+	Timestamp string `json:"timestamp"`
+	//是否是删除
+	IsDelete bool `json:"is_delete"`
+	//合约，删除时为空
+	Bill *Bill `json:"bill"`
+	//相对上一个版本变化的字段，按字段名排序
+	ChangedFields []FieldChange `json:"changed_fields"`
+}
+
+//变化的字段
+type FieldChange struct {
+	//字段名，即json中的名字
+	Field string `json:"field"`
+	//上一个版本的值，没有时为空
+	Old interface{} `json:"old"`
+	//这个版本的值，删除时为空
+	New interface{} `json:"new"`
+}
+
+//比较两个版本的字段，值为空表示没有这个版本
+func diffBillFields(before []byte, after []byte) ([]FieldChange, error) {
+	oldFields := make(map[string]interface{})
+	newFields := make(map[string]interface{})
+	if before != nil {
+		if err := json.Unmarshal(before, &oldFields); err != nil {
+			return nil, fmt.Errorf("解析合约历史失败")
+		}
+	}
+	if after != nil {
+		if err := json.Unmarshal(after, &newFields); err != nil {
+			return nil, fmt.Errorf("解析合约历史失败")
+		}
+	}
+
+	names := make([]string, 0)
+	for name := range oldFields {
+		names = append(names, name)
+	}
+	for name := range newFields {
+		if _, ok := oldFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := make([]FieldChange, 0)
+	for _, name := range names {
+		oldValue, _ := json.Marshal(oldFields[name])
+		newValue, _ := json.Marshal(newFields[name])
+		if string(oldValue) == string(newValue) {
+			continue
+		}
+		changes = append(changes, FieldChange{
+			Field: name,
+			Old:   oldFields[name],
+			New:   newFields[name],
+		})
+	}
+	return changes, nil
+}
+
+//查询所有合约信息
+//按账本中的顺序返回每个版本，删除后再发布的版本与空版本比较
+//只有参与合约的用户可以查询
+func (a *BillChaincode) queryWholeBill(stub shim.ChaincodeStubInterface, userCode string, contractCode string) pb.Response {
+	key_id := contractCode
+	err := checkContractParticipant(stub, userCode, key_id)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
+	}
+	//查询合约——fabric的API查询历史
+	resultsIterator, err := stub.GetHistoryForKey(key_id)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, "查询合约历史失败")
+	}
+	defer resultsIterator.Close()
+
+	history := make([]BillVersion, 0)
+	var previous []byte
+	//循环遍历
+	for resultsIterator.HasNext() {
+		historyData, err := resultsIterator.Next()
+		if err != nil {
+			return getErrorRet(stub, client.Code_Ledger_Error, "遍历合约历史失败")
+		}
+
+		version := BillVersion{
+			TxId:     historyData.TxId,
+			IsDelete: historyData.IsDelete,
+		}
+		if historyData.Timestamp != nil {
+			version.Timestamp = time.Unix(historyData.Timestamp.Seconds, int64(historyData.Timestamp.Nanos)).UTC().Format(Time_Layout)
+		}
+		//删除操作没有合约数据
+		var current []byte
+		if !historyData.IsDelete && historyData.Value != nil {
+			current = historyData.Value
+			version.Bill = &Bill{}
+			if err := json.Unmarshal(current, version.Bill); err != nil {
+				return getErrorRet(stub, client.Code_Invalid_Content, "解析合约历史失败")
+			}
+		}
+		version.ChangedFields, err = diffBillFields(previous, current)
+		if err != nil {
+			return getErrorRet(stub, client.Code_Invalid_Content, err.Error())
+		}
+		previous = current
+		history = append(history, version)
+	}
+
+	return getSuccessRet(stub, "", history)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fabric_asset/client"
+	"fmt"
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	mspprotos "github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//交易提交者身份和用户登记
+//用户代码由管理员绑定到证书身份，发布、投标、成交等操作校验提交者是否是该用户
+
+//用户角色
+const (
+	//发布方
+	User_Role_Publisher = "publisher"
+	//供应商，可以投标
+	User_Role_Supplier = "supplier"
+	//采购方，确认成交
+	User_Role_Purchaser = "purchaser"
+)
+
+//登记的用户
+type User struct {
+	//用户代码
+	UserCode string `json:"user_code"`
+	//证书身份，格式为 MSP ID/证书名
+	Identity string `json:"identity"`
+	//角色：publisher、supplier、purchaser
+	Roles []string `json:"roles"`
+}
+
+//解析交易提交者的身份
+func getCreator(stub shim.ChaincodeStubInterface) (*mspprotos.SerializedIdentity, error) {
+	creator, err := stub.GetCreator()
+	if err != nil || creator == nil {
+		return nil, fmt.Errorf("获取提交者身份失败")
+	}
+	identity := &mspprotos.SerializedIdentity{}
+	if err := proto.Unmarshal(creator, identity); err != nil {
+		return nil, fmt.Errorf("解析提交者身份失败")
+	}
+	return identity, nil
+}
+
+//交易提交者的标识，格式为 MSP ID/证书名
+func getCreatorIdentity(stub shim.ChaincodeStubInterface) (string, error) {
+	identity, err := getCreator(stub)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(identity.IdBytes)
+	if block == nil {
+		return "", fmt.Errorf("解析提交者证书失败")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("解析提交者证书失败")
+	}
+	return identity.Mspid + "/" + cert.Subject.CommonName, nil
+}
+
+//管理员的key
+func constructAdminKey(stub shim.ChaincodeStubInterface) (string, error) {
+	return stub.CreateCompositeKey("config", []string{"admin"})
+}
+
+//保存管理员的MSP
+func putAdmin(stub shim.ChaincodeStubInterface, mspID string) error {
+	key, err := constructAdminKey(stub)
+	if err != nil {
+		return fmt.Errorf("创建key失败 %s", err)
+	}
+	if err := stub.PutState(key, []byte(mspID)); err != nil {
+		return fmt.Errorf("保存管理员失败 %s", err)
+	}
+	return nil
+}
+
+//校验提交者是否属于管理员的MSP
+func checkAdminPermission(stub shim.ChaincodeStubInterface) error {
+	key, err := constructAdminKey(stub)
+	if err != nil {
+		return fmt.Errorf("创建key失败 %s", err)
+	}
+	admin, err := stub.GetState(key)
+	if err != nil || admin == nil {
+		return fmt.Errorf("没有设置管理员")
+	}
+	identity, err := getCreator(stub)
+	if err != nil {
+		return err
+	}
+	if identity.Mspid != string(admin) {
+		return fmt.Errorf("只有管理员可以登记用户")
+	}
+	return nil
+}
+
+//用户的key
+func constructUserKey(stub shim.ChaincodeStubInterface, userCode string) (string, error) {
+	return stub.CreateCompositeKey("user", []string{userCode})
+}
+
+//查询登记的用户
+func getUser(stub shim.ChaincodeStubInterface, userCode string) (User, bool) {
+	var user User
+	key, err := constructUserKey(stub, userCode)
+	if err != nil {
+		return user, false
+	}
+	b, err := stub.GetState(key)
+	if err != nil || b == nil {
+		return user, false
+	}
+	if err := json.Unmarshal(b, &user); err != nil {
+		return user, false
+	}
+	return user, true
+}
+
+//用户是否有某个角色
+func hasRole(user User, role string) bool {
+	for _, r := range user.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+//校验用户已登记并有该角色
+func checkUserRole(stub shim.ChaincodeStubInterface, userCode string, role string) error {
+	user, ok := getUser(stub, userCode)
+	if !ok {
+		return fmt.Errorf("用户%s没有登记", userCode)
+	}
+	if !hasRole(user, role) {
+		return fmt.Errorf("用户%s不是%s", userCode, role)
+	}
+	return nil
+}
+
+//校验提交者就是该用户，并且有该角色
+func checkUserPermission(stub shim.ChaincodeStubInterface, userCode string, role string) error {
+	if err := checkUserRole(stub, userCode, role); err != nil {
+		return err
+	}
+	return checkUserIdentity(stub, userCode)
+}
+
+//校验提交者就是该用户
+func checkUserIdentity(stub shim.ChaincodeStubInterface, userCode string) error {
+	user, ok := getUser(stub, userCode)
+	if !ok {
+		return fmt.Errorf("用户%s没有登记", userCode)
+	}
+	identity, err := getCreatorIdentity(stub)
+	if err != nil {
+		return err
+	}
+	if identity != user.Identity {
+		return fmt.Errorf("提交者不是用户%s", userCode)
+	}
+	return nil
+}
+
+//登记用户，只有管理员可以登记，重复登记时覆盖
+func (a *BillChaincode) registerUser(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//判断输入参数个数
+	if len(args) != 1 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
+	}
+	if err := checkAdminPermission(stub); err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
+	}
+
+	//解析
+	user := User{}
+	err := json.Unmarshal([]byte(args[0]), &user)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "解析失败")
+	}
+	if user.UserCode == "" || user.Identity == "" {
+		return getErrorRet(stub, client.Code_Invalid_Content, "用户代码和证书身份不能为空")
+	}
+	if len(user.Roles) == 0 {
+		return getErrorRet(stub, client.Code_Invalid_Content, "角色不能为空")
+	}
+	for _, role := range user.Roles {
+		if role != User_Role_Publisher && role != User_Role_Supplier && role != User_Role_Purchaser {
+			return getErrorRet(stub, client.Code_Invalid_Content, "角色必须是publisher、supplier或purchaser")
+		}
+	}
+
+	//保存
+	key, err := constructUserKey(stub, user.UserCode)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, "创建key失败")
+	}
+	b, err := json.Marshal(user)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, "序列化失败")
+	}
+	if err := stub.PutState(key, b); err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, "用户保存失败")
+	}
+	return getSuccessRet(stub, "登记用户成功", user)
+}
+
+//查询登记的用户
+func (a *BillChaincode) queryUser(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//判断输入参数个数
+	if len(args) != 1 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
+	}
+	user, ok := getUser(stub, args[0])
+	if !ok {
+		return getErrorRet(stub, client.Code_Not_Found, "用户不存在")
+	}
+	return getSuccessRet(stub, "", user)
+}
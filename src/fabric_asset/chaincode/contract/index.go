@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fabric_asset/client"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//按用户查询合约
+//user~role~contract索引记录用户作为发布方、采购方、投标方参与的合约，保存合约和投标时维护
+
+//用户在合约中的角色
+const (
+	Contract_Role_Publisher = "publisher"
+	Contract_Role_Purchaser = "purchaser"
+	Contract_Role_Bidder    = "bidder"
+)
+
+//每页最多条数
+const Max_Page_Size = 100
+
+//保存用户参与合约的索引，重复保存不影响
+func putUserIndex(stub shim.ChaincodeStubInterface, userCode string, role string, contractCode string) error {
+	if userCode == "" {
+		return nil
+	}
+	key, err := stub.CreateCompositeKey("user~role~contract", []string{userCode, role, contractCode})
+	if err != nil {
+		return fmt.Errorf("创建key失败 %s", err)
+	}
+	if err := stub.PutState(key, []byte{0x00}); err != nil {
+		return fmt.Errorf("保存索引失败 %s", err)
+	}
+	return nil
+}
+
+//校验用户参与了合约，作为发布方、采购方或投标方
+func checkContractParticipant(stub shim.ChaincodeStubInterface, userCode string, contractCode string) error {
+	for _, role := range []string{Contract_Role_Publisher, Contract_Role_Purchaser, Contract_Role_Bidder} {
+		key, err := stub.CreateCompositeKey("user~role~contract", []string{userCode, role, contractCode})
+		if err != nil {
+			return fmt.Errorf("创建key失败 %s", err)
+		}
+		b, err := stub.GetState(key)
+		if err != nil {
+			return fmt.Errorf("查询索引失败")
+		}
+		if b != nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("用户%s没有参与合约", userCode)
+}
+
+//取出用户参与的合约代码，role为空时包含所有角色，按角色和合约代码排序并去重
+func getUserContractCodes(stub shim.ChaincodeStubInterface, userCode string, role string) ([]string, error) {
+	attrs := []string{userCode}
+	if role != "" {
+		attrs = append(attrs, role)
+	}
+	resultsIterator, err := stub.GetStateByPartialCompositeKey("user~role~contract", attrs)
+	if err != nil {
+		return nil, fmt.Errorf("查询索引失败")
+	}
+	defer resultsIterator.Close()
+
+	codes := make([]string, 0)
+	seen := make(map[string]bool)
+	for resultsIterator.HasNext() {
+		kv, err := resultsIterator.Next()
+		if err != nil {
+			return nil, fmt.Errorf("遍历索引失败")
+		}
+		_, keys, err := stub.SplitCompositeKey(kv.Key)
+		if err != nil || len(keys) != 3 {
+			return nil, fmt.Errorf("解析key失败")
+		}
+		if seen[keys[2]] {
+			continue
+		}
+		seen[keys[2]] = true
+		codes = append(codes, keys[2])
+	}
+	return codes, nil
+}
+
+//查询用户参与的合约，提交者已在query中校验
+//按状态和发布时间过滤，发布时间包含开始不包含结束，页码从0开始
+func (a *BillChaincode) queryUserBills(stub shim.ChaincodeStubInterface, query_bill *QueryBill) pb.Response {
+	if query_bill.Role != "" && query_bill.Role != Contract_Role_Publisher && query_bill.Role != Contract_Role_Purchaser && query_bill.Role != Contract_Role_Bidder {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "角色必须是publisher、purchaser或bidder")
+	}
+	if query_bill.ContractStatus != "" {
+		if _, ok := contractStatusNames[query_bill.ContractStatus]; !ok {
+			return getErrorRet(stub, client.Code_Invalid_Argument, "合约状态错误")
+		}
+	}
+	if query_bill.PageSize <= 0 || query_bill.PageSize > Max_Page_Size {
+		return getErrorRet(stub, client.Code_Invalid_Argument, fmt.Sprintf("每页条数必须在1到%d之间", Max_Page_Size))
+	}
+	if query_bill.Page < 0 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "页码不能小于0")
+	}
+	start, err := parseBillTime(query_bill.StartTime)
+	if query_bill.StartTime != "" && err != nil {
+		return getErrorRet(stub, client.Code_Invalid_Argument, fmt.Sprintf("开始时间格式错误，应为%s", Time_Layout))
+	}
+	end, err := parseBillTime(query_bill.EndTime)
+	if query_bill.EndTime != "" && err != nil {
+		return getErrorRet(stub, client.Code_Invalid_Argument, fmt.Sprintf("结束时间格式错误，应为%s", Time_Layout))
+	}
+
+	codes, err := getUserContractCodes(stub, query_bill.UserCode, query_bill.Role)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, err.Error())
+	}
+
+	list := make([]Bill, 0)
+	skip := query_bill.Page * query_bill.PageSize
+	hasMore := false
+	for _, code := range codes {
+		bill, bl := a.getBill(stub, code)
+		if !bl {
+			continue
+		}
+		if query_bill.ContractStatus != "" && bill.ContractStatus != query_bill.ContractStatus {
+			continue
+		}
+		if query_bill.StartTime != "" || query_bill.EndTime != "" {
+			created, err := parseBillTime(bill.CreateTime)
+			if err != nil {
+				continue
+			}
+			if query_bill.StartTime != "" && created.Before(start) {
+				continue
+			}
+			if query_bill.EndTime != "" && !created.Before(end) {
+				continue
+			}
+		}
+		//跳过前面的页
+		if skip > 0 {
+			skip--
+			continue
+		}
+		//多出一条说明还有下一页
+		if len(list) == query_bill.PageSize {
+			hasMore = true
+			break
+		}
+		list = append(list, bill)
+	}
+
+	page := billPage{
+		List:     list,
+		Page:     query_bill.Page,
+		PageSize: query_bill.PageSize,
+		HasMore:  hasMore,
+	}
+	return getSuccessRet(stub, "", page)
+}
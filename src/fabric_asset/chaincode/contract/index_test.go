@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fabric_asset/client"
+	"testing"
+)
+
+func TestQueryRequiresOwnIdentity(t *testing.T) {
+	s := newTestStub(t)
+	s.createBill("C1", Bid_Mode_Open)
+	query := func(userCode string, versionType string) string {
+		return toJSON(t, QueryBill{
+			UserCode:     userCode,
+			ContractCode: "C1",
+			VersionType:  versionType,
+			PageSize:     10,
+		})
+	}
+
+	//冒用别人的用户代码
+	for _, versionType := range []string{"last", "whole", "list"} {
+		s.as("s1").expectCode(client.Code_Permission_Denied, "query", query("pub", versionType))
+		s.as("s1").expectCode(client.Code_Invalid_Argument, "query", query("", versionType))
+	}
+
+	//没有参与合约的用户不能查询
+	s.as("s1").expectCode(client.Code_Permission_Denied, "query", query("s1", "last"))
+	s.as("s1").expectCode(client.Code_Permission_Denied, "query", query("s1", "whole"))
+
+	//发布方、采购方和投标方可以查询
+	s.at("2018-06-02 00:00:00")
+	s.bid("C1", "s1", 100)
+	for _, userCode := range []string{"pub", "buyer", "s1"} {
+		var bills []Bill
+		s.as(userCode).mustInvoke(&bills, "query", query(userCode, "last"))
+		if len(bills) != 1 || bills[0].ContractCode != "C1" {
+			t.Errorf("%s 查询到的合约错误：%+v", userCode, bills)
+		}
+		var page billPage
+		s.as(userCode).mustInvoke(&page, "query", query(userCode, "list"))
+		if len(page.List) != 1 || page.List[0].ContractCode != "C1" {
+			t.Errorf("%s 参与的合约错误：%+v", userCode, page)
+		}
+	}
+	s.as("s2").expectCode(client.Code_Permission_Denied, "query", query("s2", "last"))
+}
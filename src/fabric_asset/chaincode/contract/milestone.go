@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fabric_asset/client"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"strconv"
+)
+
+//履约里程碑
+//成交后、开始履行前由发布方设置里程碑，金额合计等于中标金额
+//履行中由中标方提交，采购方验收或驳回，驳回后可以重新提交，全部验收后合约完成
+//设置了支付链码时，验收通过即调用支付链码的invoke从采购方转账给中标方，账户名为用户代码
+
+//里程碑状态
+const (
+	//待提交
+	Milestone_Status_Pending = "pending"
+	//已提交，待验收
+	Milestone_Status_Submitted = "submitted"
+	//已验收
+	Milestone_Status_Accepted = "accepted"
+	//已驳回
+	Milestone_Status_Rejected = "rejected"
+)
+
+//里程碑
+type Milestone struct {
+	//序号，从0开始
+	Index int `json:"index"`
+	//描述
+	Description string `json:"description"`
+	//应交付时间，格式同合约时间
+	DueDate string `json:"due_date"`
+	//金额
+	Amount int `json:"amount"`
+	//状态
+	//pending：待提交 submitted：已提交 accepted：已验收 rejected：已驳回
+	Status string `json:"status"`
+	//最近一次提交的时间和说明
+	SubmitTime string `json:"submit_time"`
+	SubmitNote string `json:"submit_note"`
+	//提交时是否已超过应交付时间
+	Overdue bool `json:"overdue"`
+	//最近一次验收的时间和说明
+	ReviewTime string `json:"review_time"`
+	ReviewNote string `json:"review_note"`
+	//付款的交易id，即验收的交易id，没有设置支付链码时为空
+	PaymentTxId string `json:"payment_tx_id"`
+}
+
+//设置里程碑
+type SetMilestones struct {
+	//发布方用户代码
+	UserCode string `json:"user_code"`
+	//合同代码
+	ContractCode string `json:"contract_code"`
+	//里程碑，只需要填描述、应交付时间和金额
+	Milestones []Milestone `json:"milestones"`
+	//支付链码名，为空时不付款
+	PaymentChaincode string `json:"payment_chaincode"`
+	//支付链码所在的通道，只能为空或当前通道，其他通道的链码只能查询，不能转账
+	PaymentChannel string `json:"payment_channel"`
+}
+
+//提交或验收里程碑
+type MilestoneAction struct {
+	//提交时为中标方用户代码，验收时为采购方用户代码
+	UserCode string `json:"user_code"`
+	//合同代码
+	ContractCode string `json:"contract_code"`
+	//里程碑序号
+	Index int `json:"index"`
+	//验收时是否通过
+	Accept bool `json:"accept"`
+	//说明
+	Note string `json:"note"`
+}
+
+//设置里程碑，重复设置时覆盖
+func (a *BillChaincode) setMilestones(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//判断输入参数个数
+	if len(args) != 1 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
+	}
+
+	//解析
+	set := SetMilestones{}
+	err := json.Unmarshal([]byte(args[0]), &set)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Invalid_Content, "解析失败")
+	}
+
+	//判断合约是否存在
+	bill, bl := a.getBill(stub, set.ContractCode)
+	if !bl {
+		return getErrorRet(stub, client.Code_Not_Found, "合约不存在")
+	}
+	//只有发布方可以设置
+	if set.UserCode != bill.UserCode {
+		return getErrorRet(stub, client.Code_Permission_Denied, "只有合约发布方可以设置里程碑")
+	}
+	err = checkUserPermission(stub, set.UserCode, User_Role_Publisher)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
+	}
+	//成交后、开始履行前才能设置
+	if bill.ContractStatus != Contract_Status_Awarded {
+		return getErrorRet(stub, client.Code_Illegal_Transition, fmt.Sprintf("合约状态为%s，不能设置里程碑", contractStatusNames[bill.ContractStatus]))
+	}
+
+	if len(set.Milestones) == 0 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "里程碑不能为空")
+	}
+	//跨通道调用链码是只读的，转账不会生效
+	if set.PaymentChannel != "" && set.PaymentChannel != stub.GetChannelID() {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "支付链码必须在当前通道")
+	}
+	total := 0
+	milestones := make([]Milestone, 0, len(set.Milestones))
+	for i, m := range set.Milestones {
+		if m.Description == "" {
+			return getErrorRet(stub, client.Code_Invalid_Argument, fmt.Sprintf("第%d个里程碑的描述不能为空", i))
+		}
+		if _, err := parseBillTime(m.DueDate); err != nil {
+			return getErrorRet(stub, client.Code_Invalid_Content, fmt.Sprintf("第%d个里程碑的应交付时间格式错误，应为%s", i, Time_Layout))
+		}
+		if m.Amount <= 0 {
+			return getErrorRet(stub, client.Code_Invalid_Argument, fmt.Sprintf("第%d个里程碑的金额必须大于0", i))
+		}
+		total += m.Amount
+		milestones = append(milestones, Milestone{
+			Index:       i,
+			Description: m.Description,
+			DueDate:     m.DueDate,
+			Amount:      m.Amount,
+			Status:      Milestone_Status_Pending,
+		})
+	}
+	if total != bill.DealAmount {
+		return getErrorRet(stub, client.Code_Invalid_Argument, fmt.Sprintf("里程碑金额合计%d，必须等于中标金额%d", total, bill.DealAmount))
+	}
+
+	bill.Milestones = milestones
+	bill.PaymentChaincode = set.PaymentChaincode
+	_, bl = a.putBill(stub, bill)
+	if !bl {
+		return getErrorRet(stub, client.Code_Ledger_Error, "合约保存失败")
+	}
+	return getSuccessRet(stub, "设置里程碑成功", bill)
+}
+
+//取出履行中合约的里程碑
+func (a *BillChaincode) getMilestone(stub shim.ChaincodeStubInterface, action MilestoneAction) (Bill, *Milestone, pb.Response, bool) {
+	bill, bl := a.getBill(stub, action.ContractCode)
+	if !bl {
+		return bill, nil, getErrorRet(stub, client.Code_Not_Found, "合约不存在"), false
+	}
+	if bill.ContractStatus != Contract_Status_InProgress {
+		return bill, nil, getErrorRet(stub, client.Code_Illegal_Transition, fmt.Sprintf("合约状态为%s，不能处理里程碑", contractStatusNames[bill.ContractStatus])), false
+	}
+	if action.Index < 0 || action.Index >= len(bill.Milestones) {
+		return bill, nil, getErrorRet(stub, client.Code_Not_Found, "里程碑不存在"), false
+	}
+	return bill, &bill.Milestones[action.Index], pb.Response{}, true
+}
+
+//中标方提交里程碑，待提交或被驳回的里程碑可以提交
+func (a *BillChaincode) submitMilestone(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//判断输入参数个数
+	if len(args) != 1 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
+	}
+
+	//解析
+	action := MilestoneAction{}
+	err := json.Unmarshal([]byte(args[0]), &action)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Invalid_Content, "解析失败")
+	}
+	bill, milestone, res, ok := a.getMilestone(stub, action)
+	if !ok {
+		return res
+	}
+	//只有中标方可以提交
+	if action.UserCode != bill.WinnerUserCode {
+		return getErrorRet(stub, client.Code_Permission_Denied, "只有中标方可以提交里程碑")
+	}
+	err = checkUserPermission(stub, action.UserCode, User_Role_Supplier)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
+	}
+	if milestone.Status != Milestone_Status_Pending && milestone.Status != Milestone_Status_Rejected {
+		return getErrorRet(stub, client.Code_Already_Exists, "里程碑已经提交")
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, err.Error())
+	}
+	due, _ := parseBillTime(milestone.DueDate)
+	milestone.Status = Milestone_Status_Submitted
+	milestone.SubmitTime = txTime.Format(Time_Layout)
+	milestone.SubmitNote = action.Note
+	milestone.Overdue = txTime.After(due)
+	_, bl := a.putBill(stub, bill)
+	if !bl {
+		return getErrorRet(stub, client.Code_Ledger_Error, "合约保存失败")
+	}
+	return getSuccessRet(stub, "提交里程碑成功", bill)
+}
+
+//采购方验收里程碑，全部验收后合约完成
+func (a *BillChaincode) reviewMilestone(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//判断输入参数个数
+	if len(args) != 1 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
+	}
+
+	//解析
+	action := MilestoneAction{}
+	err := json.Unmarshal([]byte(args[0]), &action)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Invalid_Content, "解析失败")
+	}
+	bill, milestone, res, ok := a.getMilestone(stub, action)
+	if !ok {
+		return res
+	}
+	//只有采购方可以验收
+	if action.UserCode != bill.PurchaseUserCode {
+		return getErrorRet(stub, client.Code_Permission_Denied, "只有采购方可以验收里程碑")
+	}
+	err = checkUserPermission(stub, action.UserCode, User_Role_Purchaser)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
+	}
+	if milestone.Status != Milestone_Status_Submitted {
+		return getErrorRet(stub, client.Code_Illegal_Transition, "里程碑没有提交，不能验收")
+	}
+	if !action.Accept && action.Note == "" {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "驳回时说明不能为空")
+	}
+
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, err.Error())
+	}
+	milestone.ReviewTime = txTime.Format(Time_Layout)
+	milestone.ReviewNote = action.Note
+	if !action.Accept {
+		milestone.Status = Milestone_Status_Rejected
+	} else {
+		milestone.Status = Milestone_Status_Accepted
+		//验收通过后付款
+		if bill.PaymentChaincode != "" {
+			err = releasePayment(stub, bill, *milestone)
+			if err != nil {
+				return getErrorRet(stub, client.Code_Payment_Failed, err.Error())
+			}
+			milestone.PaymentTxId = stub.GetTxID()
+		}
+	}
+
+	//全部验收后合约完成
+	msg := "验收里程碑成功"
+	if allMilestonesAccepted(bill) {
+		err = transitBill(&bill, Contract_Status_Completed)
+		if err != nil {
+			return getErrorRet(stub, client.Code_Illegal_Transition, err.Error())
+		}
+		msg = "验收里程碑成功，合约已完成"
+	}
+	_, bl := a.putBill(stub, bill)
+	if !bl {
+		return getErrorRet(stub, client.Code_Ledger_Error, "合约保存失败")
+	}
+	return getSuccessRet(stub, msg, bill)
+}
+
+//里程碑是否全部验收
+func allMilestonesAccepted(bill Bill) bool {
+	if len(bill.Milestones) == 0 {
+		return false
+	}
+	for _, m := range bill.Milestones {
+		if m.Status != Milestone_Status_Accepted {
+			return false
+		}
+	}
+	return true
+}
+
+//调用支付链码，从采购方转账给中标方
+func releasePayment(stub shim.ChaincodeStubInterface, bill Bill, milestone Milestone) error {
+	invokeArgs := [][]byte{
+		[]byte("invoke"),
+		[]byte(bill.PurchaseUserCode),
+		[]byte(bill.WinnerUserCode),
+		[]byte(strconv.Itoa(milestone.Amount)),
+	}
+	response := stub.InvokeChaincode(bill.PaymentChaincode, invokeArgs, "")
+	if response.Status != shim.OK {
+		return fmt.Errorf("付款失败：%s", response.Message)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fabric_asset/client"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"strconv"
+	"testing"
+)
+
+//测试用的支付链码，只实现转账，余额不足时失败
+type testPayment struct {
+}
+
+func (p *testPayment) Init(stub shim.ChaincodeStubInterface) pb.Response {
+	return shim.Success(nil)
+}
+
+func (p *testPayment) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
+	_, args := stub.GetFunctionAndParameters()
+	from, _ := stub.GetState(args[0])
+	to, _ := stub.GetState(args[1])
+	fromv, _ := strconv.Atoi(string(from))
+	tov, _ := strconv.Atoi(string(to))
+	v, _ := strconv.Atoi(args[2])
+	if fromv < v {
+		return shim.Error("原账户的金额不够")
+	}
+	stub.PutState(args[0], []byte(strconv.Itoa(fromv-v)))
+	stub.PutState(args[1], []byte(strconv.Itoa(tov+v)))
+	return shim.Success(nil)
+}
+
+//成交给s1并开始履行，中标金额100
+func startContract(t *testing.T, s *testStub, set SetMilestones) {
+	s.createBill("C1", Bid_Mode_Open)
+	s.at("2018-06-02 00:00:00")
+	s.bid("C1", "s1", 100)
+	s.at("2018-06-10 00:00:00")
+	s.as("pub").mustInvoke(nil, "link_contract_deal", toJSON(t, BillDeal{UserCode: "pub", ContractCode: "C1", WinnerUserCode: "s1"}))
+	s.as("buyer").mustInvoke(nil, "link_contract_confirm", toJSON(t, BillConfirm{UserCode: "buyer", ContractCode: "C1"}))
+	s.as("pub").mustInvoke(nil, "set_milestones", toJSON(t, set))
+	s.as("pub").mustInvoke(nil, "link_contract_start", toJSON(t, BillStart{UserCode: "pub", ContractCode: "C1"}))
+}
+
+func milestoneAction(t *testing.T, userCode string, index int, accept bool, note string) string {
+	return toJSON(t, MilestoneAction{UserCode: userCode, ContractCode: "C1", Index: index, Accept: accept, Note: note})
+}
+
+func TestMilestonePayment(t *testing.T) {
+	s := newTestStub(t)
+	s.ChannelID = "mychannel"
+	payment := shim.NewMockStub("payment", new(testPayment))
+	payment.State["buyer"] = []byte("150")
+	s.MockPeerChaincode("payment", payment)
+
+	startContract(t, s, SetMilestones{
+		UserCode:     "pub",
+		ContractCode: "C1",
+		Milestones: []Milestone{
+			{Description: "设计", DueDate: "2018-07-01 00:00:00", Amount: 40},
+			{Description: "交付", DueDate: "2018-08-01 00:00:00", Amount: 60},
+		},
+		PaymentChaincode: "payment",
+		PaymentChannel:   "mychannel",
+	})
+
+	//驳回不付款
+	s.at("2018-06-20 00:00:00")
+	s.as("s1").mustInvoke(nil, "submit_milestone", milestoneAction(t, "s1", 0, false, "设计稿"))
+	s.as("buyer").expectCode(client.Code_Invalid_Argument, "review_milestone", milestoneAction(t, "buyer", 0, false, ""))
+	s.as("buyer").mustInvoke(nil, "review_milestone", milestoneAction(t, "buyer", 0, false, "缺少图纸"))
+	s.as("s1").mustInvoke(nil, "submit_milestone", milestoneAction(t, "s1", 0, false, "补充图纸"))
+	var bill Bill
+	s.as("buyer").mustInvoke(&bill, "review_milestone", milestoneAction(t, "buyer", 0, true, ""))
+	if bill.Milestones[0].PaymentTxId == "" || string(payment.State["s1"]) != "40" {
+		t.Errorf("验收后应付款：%+v %s", bill.Milestones[0], payment.State["s1"])
+	}
+
+	//逾期提交
+	s.at("2018-08-02 00:00:00")
+	s.as("s1").mustInvoke(&bill, "submit_milestone", milestoneAction(t, "s1", 1, false, ""))
+	if !bill.Milestones[1].Overdue {
+		t.Errorf("超过应交付时间的提交应标记逾期：%+v", bill.Milestones[1])
+	}
+	s.as("buyer").mustInvoke(&bill, "review_milestone", milestoneAction(t, "buyer", 1, true, ""))
+	if bill.ContractStatus != Contract_Status_Completed {
+		t.Errorf("全部验收后合约应完成：%s", bill.ContractStatus)
+	}
+	if string(payment.State["buyer"]) != "50" || string(payment.State["s1"]) != "100" {
+		t.Errorf("付款后余额错误：buyer=%s s1=%s", payment.State["buyer"], payment.State["s1"])
+	}
+}
+
+func TestMilestonePaymentFailed(t *testing.T) {
+	s := newTestStub(t)
+	payment := shim.NewMockStub("payment", new(testPayment))
+	payment.State["buyer"] = []byte("10")
+	s.MockPeerChaincode("payment", payment)
+	startContract(t, s, SetMilestones{
+		UserCode:         "pub",
+		ContractCode:     "C1",
+		Milestones:       []Milestone{{Description: "交付", DueDate: "2018-07-01 00:00:00", Amount: 100}},
+		PaymentChaincode: "payment",
+	})
+
+	//付款失败时验收不生效
+	s.at("2018-06-20 00:00:00")
+	s.as("s1").mustInvoke(nil, "submit_milestone", milestoneAction(t, "s1", 0, false, ""))
+	s.as("buyer").expectCode(client.Code_Payment_Failed, "review_milestone", milestoneAction(t, "buyer", 0, true, ""))
+	if bill := s.lastBill("C1"); bill.Milestones[0].Status != Milestone_Status_Submitted || bill.ContractStatus != Contract_Status_InProgress {
+		t.Errorf("付款失败后里程碑不应验收：%+v", bill)
+	}
+}
+
+func TestSetMilestonesRejectsOtherChannel(t *testing.T) {
+	s := newTestStub(t)
+	s.ChannelID = "mychannel"
+	s.createBill("C1", Bid_Mode_Open)
+	s.at("2018-06-02 00:00:00")
+	s.bid("C1", "s1", 100)
+	s.at("2018-06-10 00:00:00")
+	s.as("pub").mustInvoke(nil, "link_contract_deal", toJSON(t, BillDeal{UserCode: "pub", ContractCode: "C1", WinnerUserCode: "s1"}))
+
+	set := SetMilestones{
+		UserCode:         "pub",
+		ContractCode:     "C1",
+		Milestones:       []Milestone{{Description: "交付", DueDate: "2018-07-01 00:00:00", Amount: 100}},
+		PaymentChaincode: "payment",
+		PaymentChannel:   "otherchannel",
+	}
+	//其他通道的转账不会生效
+	s.as("pub").expectCode(client.Code_Invalid_Argument, "set_milestones", toJSON(t, set))
+	//金额合计必须等于中标金额
+	set.PaymentChannel = ""
+	set.Milestones[0].Amount = 90
+	s.as("pub").expectCode(client.Code_Invalid_Argument, "set_milestones", toJSON(t, set))
+	set.Milestones[0].Amount = 100
+	s.as("pub").mustInvoke(nil, "set_milestones", toJSON(t, set))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"fabric_asset/client"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+//统一的返回结构
+//所有方法的成功和失败都在payload中返回同一个结构，失败时错误信息为纯文本
+//版本和错误码定义在fabric_asset/client中，客户端用同一个包解析
+
+//链码的返回结构
+type chaincodeRet struct {
+	//返回结构的版本
+	Version int `json:"version"`
+	//1代表成功，0代表失败
+	Result int `json:"result"`
+	//错误码，0代表没有错误
+	Code int `json:"code"`
+	//提示或错误信息
+	Message string `json:"message"`
+	//返回的数据，没有时为null
+	Data interface{} `json:"data"`
+	//交易id
+	TxId string `json:"tx_id"`
+}
+
+//分页的合约列表
+type billPage struct {
+	//合约列表
+	List []Bill `json:"list"`
+	//页码，从0开始
+	Page int `json:"page"`
+	//每页条数
+	PageSize int `json:"page_size"`
+	//是否还有下一页
+	HasMore bool `json:"has_more"`
+}
+
+//序列化返回结构
+func marshalRet(stub shim.ChaincodeStubInterface, result int, code int, msg string, data interface{}) []byte {
+	r := chaincodeRet{
+		Version: client.Response_Version,
+		Result:  result,
+		Code:    code,
+		Message: msg,
+		Data:    data,
+		TxId:    stub.GetTxID(),
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		//数据无法序列化时只返回错误
+		r.Result = 0
+		r.Code = client.Code_Invalid_Content
+		r.Message = "序列化失败"
+		r.Data = nil
+		b, _ = json.Marshal(r)
+	}
+	return b
+}
+
+//返回成功
+func getSuccessRet(stub shim.ChaincodeStubInterface, msg string, data interface{}) pb.Response {
+	return shim.Success(marshalRet(stub, 1, client.Code_Success, msg, data))
+}
+
+//返回失败，错误信息为纯文本，payload为返回结构
+func getErrorRet(stub shim.ChaincodeStubInterface, code int, msg string) pb.Response {
+	if msg == "" {
+		msg = client.CodeMessages[code]
+	}
+	return pb.Response{
+		Status:  shim.ERROR,
+		Message: msg,
+		Payload: marshalRet(stub, 0, code, msg, nil),
+	}
+}
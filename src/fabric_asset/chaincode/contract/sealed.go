@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fabric_asset/client"
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//密封投标
+//投标时间内只提交承诺哈希，投标结束后到揭标结束前通过transient map揭示金额和盐
+//成交时校验承诺，未揭标或不一致的投标作废，金额最低的有效投标中标
+
+//投标方式
+const (
+	//公开投标
+	Bid_Mode_Open = "open"
+	//密封投标
+	Bid_Mode_Sealed = "sealed"
+)
+
+//揭标
+type RevealBid struct {
+	//投标方用户代码
+	UserCode string `json:"user_code"`
+	//合同代码
+	ContractCode string `json:"contract_code"`
+}
+
+//投标承诺，sha256(合同代码|投标方用户代码|金额|盐)的十六进制
+//包含合同代码和投标方，不能照抄别人的承诺
+func bidCommitment(contractCode string, userCode string, amount int, salt string) string {
+	sum := sha256.Sum256([]byte(contractCode + "|" + userCode + "|" + strconv.Itoa(amount) + "|" + salt))
+	return hex.EncodeToString(sum[:])
+}
+
+//交易时间是否在揭标时间内，从投标结束到揭标结束，包含开始不包含结束
+func inRevealWindow(bill Bill, t time.Time) bool {
+	start, err := parseBillTime(bill.BidingEndTime)
+	if err != nil {
+		return false
+	}
+	end, err := parseBillTime(bill.RevealEndTime)
+	if err != nil {
+		return false
+	}
+	return !t.Before(start) && t.Before(end)
+}
+
+//揭标时间是否已经结束
+func revealClosed(bill Bill, t time.Time) bool {
+	end, err := parseBillTime(bill.RevealEndTime)
+	if err != nil {
+		return false
+	}
+	return !t.Before(end)
+}
+
+//揭标
+//金额和盐放在transient map的amount和salt中，揭标后写入账本
+func (a *BillChaincode) LinkContractReveal(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	//判断输入参数个数
+	if len(args) != 1 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "参数必须是一个")
+	}
+
+	//解析
+	reveal := &RevealBid{}
+	err := json.Unmarshal([]byte(args[0]), reveal)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "解析失败")
+	}
+	transient, err := stub.GetTransient()
+	if err != nil {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "获取transient失败")
+	}
+	amount, err := strconv.Atoi(string(transient["amount"]))
+	if err != nil || amount <= 0 {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "transient中的amount必须是大于0的整数")
+	}
+	salt := string(transient["salt"])
+	if salt == "" {
+		return getErrorRet(stub, client.Code_Invalid_Argument, "transient中的salt不能为空")
+	}
+
+	//判断合约是否存在
+	bill, bl := a.getBill(stub, reveal.ContractCode)
+	if !bl {
+		return getErrorRet(stub, client.Code_Not_Found, "合约不存在")
+	}
+	if bill.BidMode != Bid_Mode_Sealed {
+		return getErrorRet(stub, client.Code_Invalid_Content, "合约不是密封投标")
+	}
+	if bill.ContractStatus != Contract_Status_Bidding {
+		return getErrorRet(stub, client.Code_Illegal_Transition, fmt.Sprintf("合约状态为%s，不能揭标", contractStatusNames[bill.ContractStatus]))
+	}
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, err.Error())
+	}
+	if !inRevealWindow(bill, txTime) {
+		return getErrorRet(stub, client.Code_Out_Of_Window, "不在揭标时间内")
+	}
+	err = checkUserPermission(stub, reveal.UserCode, User_Role_Supplier)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Permission_Denied, err.Error())
+	}
+
+	//揭示有效投标，是否与承诺一致在成交时校验
+	bids, err := a.getBids(stub, bill.ContractCode, reveal.UserCode)
+	if err != nil {
+		return getErrorRet(stub, client.Code_Ledger_Error, err.Error())
+	}
+	for _, bid := range bids {
+		if bid.BidStatus != Bid_Status_Active {
+			continue
+		}
+		if bid.Revealed {
+			return getErrorRet(stub, client.Code_Already_Exists, "已经揭标")
+		}
+		bid.Amount = amount
+		bid.Salt = salt
+		bid.Revealed = true
+		bid.RevealTime = txTime.Format(Time_Layout)
+		if !a.putBid(stub, bid) {
+			return getErrorRet(stub, client.Code_Ledger_Error, "投标保存失败")
+		}
+		return getSuccessRet(stub, "揭标成功", bid)
+	}
+	return getErrorRet(stub, client.Code_Not_Found, "没有有效投标")
+}
+
+//密封投标的中标方
+//未揭标或揭示的金额和盐与承诺不一致的投标作废，其余按金额从低到高、投标时间从早到晚排序
+func (a *BillChaincode) pickSealedWinner(stub shim.ChaincodeStubInterface, bill Bill) (*Bid, error) {
+	bids, err := a.getBids(stub, bill.ContractCode, "")
+	if err != nil {
+		return nil, err
+	}
+	valid := make([]Bid, 0)
+	for _, bid := range bids {
+		if bid.BidStatus != Bid_Status_Active {
+			continue
+		}
+		if !bid.Revealed || bidCommitment(bid.ContractCode, bid.UserCode, bid.Amount, bid.Salt) != bid.Commitment {
+			bid.BidStatus = Bid_Status_Disqualified
+			if !a.putBid(stub, bid) {
+				return nil, fmt.Errorf("投标保存失败")
+			}
+			continue
+		}
+		valid = append(valid, bid)
+	}
+	if len(valid) == 0 {
+		return nil, nil
+	}
+	sort.SliceStable(valid, func(i, j int) bool {
+		if valid[i].Amount != valid[j].Amount {
+			return valid[i].Amount < valid[j].Amount
+		}
+		if valid[i].BidTime != valid[j].BidTime {
+			return valid[i].BidTime < valid[j].BidTime
+		}
+		return valid[i].UserCode < valid[j].UserCode
+	})
+	return &valid[0], nil
+}
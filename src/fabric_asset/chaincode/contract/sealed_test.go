@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fabric_asset/client"
+	"strconv"
+	"testing"
+)
+
+//提交密封投标
+func (s *testStub) sealedBid(contractCode string, userCode string, amount int, salt string) {
+	s.as(userCode).mustInvoke(nil, "link_contract_biding", toJSON(s.t, BidingBill{
+		UserCode:     userCode,
+		ContractCode: contractCode,
+		Commitment:   bidCommitment(contractCode, userCode, amount, salt),
+	}))
+}
+
+//揭标，金额和盐通过transient传入
+func (s *testStub) reveal(contractCode string, userCode string, amount int, salt string) testRet {
+	s.withTransient(map[string][]byte{
+		"amount": []byte(strconv.Itoa(amount)),
+		"salt":   []byte(salt),
+	})
+	defer s.withTransient(nil)
+	return s.as(userCode).invoke("link_contract_reveal", toJSON(s.t, RevealBid{
+		UserCode:     userCode,
+		ContractCode: contractCode,
+	}))
+}
+
+func TestSealedBidWinner(t *testing.T) {
+	s := newTestStub(t)
+	s.createBill("C1", Bid_Mode_Sealed)
+
+	s.at("2018-06-02 00:00:00")
+	s.sealedBid("C1", "s4", 100, "d")
+	//揭示的金额与承诺不一致
+	s.sealedBid("C1", "s2", 80, "b")
+	//不揭标
+	s.sealedBid("C1", "s3", 50, "c")
+	s.sealedBid("C1", "s5", 120, "e")
+	//与s4金额相同，投标更晚
+	s.at("2018-06-03 00:00:00")
+	s.sealedBid("C1", "s1", 100, "a")
+
+	s.at("2018-06-11 00:00:00")
+	for _, r := range []struct {
+		user   string
+		amount int
+		salt   string
+	}{
+		{"s1", 100, "a"},
+		{"s2", 70, "b"},
+		{"s4", 100, "d"},
+		{"s5", 120, "e"},
+	} {
+		if ret := s.reveal("C1", r.user, r.amount, r.salt); ret.Result != 1 {
+			t.Fatalf("%s 揭标失败：%s", r.user, ret.Message)
+		}
+	}
+	//不能重复揭标
+	if ret := s.reveal("C1", "s4", 100, "d"); ret.Code != client.Code_Already_Exists {
+		t.Errorf("重复揭标的错误码为%d", ret.Code)
+	}
+
+	//揭标结束后成交，金额最低、投标最早的有效投标中标
+	s.at("2018-06-15 00:00:00")
+	var bill Bill
+	s.as("pub").mustInvoke(&bill, "link_contract_deal", toJSON(t, BillDeal{UserCode: "pub", ContractCode: "C1"}))
+	if bill.WinnerUserCode != "s4" || bill.DealAmount != 100 {
+		t.Errorf("中标方应为s4，金额100：%+v", bill)
+	}
+
+	status := make(map[string]string)
+	for _, bid := range s.listBids("C1", "all") {
+		status[bid.UserCode] = bid.BidStatus
+	}
+	want := map[string]string{
+		"s1": Bid_Status_Active,
+		"s2": Bid_Status_Disqualified,
+		"s3": Bid_Status_Disqualified,
+		"s4": Bid_Status_Active,
+		"s5": Bid_Status_Active,
+	}
+	for user, st := range want {
+		if status[user] != st {
+			t.Errorf("%s 的投标状态为%s，应为%s", user, status[user], st)
+		}
+	}
+}
+
+func TestPickSealedWinnerNoValidBid(t *testing.T) {
+	s := newTestStub(t)
+	bill := s.createBill("C1", Bid_Mode_Sealed)
+
+	s.at("2018-06-02 00:00:00")
+	s.sealedBid("C1", "s1", 100, "a")
+	s.sealedBid("C1", "s2", 90, "b")
+	s.at("2018-06-11 00:00:00")
+	if ret := s.reveal("C1", "s1", 101, "a"); ret.Result != 1 {
+		t.Fatalf("揭标失败：%s", ret.Message)
+	}
+
+	s.MockTransactionStart("pick")
+	winning, err := s.cc.pickSealedWinner(s, bill)
+	s.MockTransactionEnd("pick")
+	if err != nil || winning != nil {
+		t.Errorf("没有有效揭标时不应有中标方：%+v %v", winning, err)
+	}
+	s.at("2018-06-15 00:00:00")
+	s.as("pub").expectCode(client.Code_Not_Found, "link_contract_deal", toJSON(t, BillDeal{UserCode: "pub", ContractCode: "C1"}))
+}
+
+func TestRevealWindow(t *testing.T) {
+	s := newTestStub(t)
+	s.createBill("C1", Bid_Mode_Sealed)
+
+	s.at("2018-06-02 00:00:00")
+	s.sealedBid("C1", "s1", 100, "a")
+	//密封投标不能提交金额
+	s.as("s2").expectCode(client.Code_Invalid_Content, "link_contract_biding", toJSON(t, BidingBill{
+		UserCode:     "s2",
+		ContractCode: "C1",
+		Amount:       90,
+		Commitment:   bidCommitment("C1", "s2", 90, "b"),
+	}))
+
+	//投标结束前不能揭标
+	if ret := s.reveal("C1", "s1", 100, "a"); ret.Code != client.Code_Out_Of_Window {
+		t.Errorf("投标时间内揭标的错误码为%d", ret.Code)
+	}
+	//揭标结束前不能成交
+	s.at("2018-06-12 00:00:00")
+	s.as("pub").expectCode(client.Code_Out_Of_Window, "link_contract_deal", toJSON(t, BillDeal{UserCode: "pub", ContractCode: "C1"}))
+	//揭标结束后不能揭标
+	s.at("2018-06-15 00:00:00")
+	if ret := s.reveal("C1", "s1", 100, "a"); ret.Code != client.Code_Out_Of_Window {
+		t.Errorf("揭标结束后揭标的错误码为%d", ret.Code)
+	}
+	//只能揭示自己的投标
+	s.at("2018-06-14 00:00:00")
+	s.withTransient(map[string][]byte{"amount": []byte("100"), "salt": []byte("a")})
+	s.as("s2").expectCode(client.Code_Permission_Denied, "link_contract_reveal", toJSON(t, RevealBid{UserCode: "s1", ContractCode: "C1"}))
+	s.withTransient(nil)
+	if ret := s.reveal("C1", "s1", 100, "a"); ret.Result != 1 {
+		t.Errorf("揭标时间内揭标失败：%s", ret.Message)
+	}
+}
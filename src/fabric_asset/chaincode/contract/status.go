@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+)
+
+//合约状态机
+//发布 -> 投标中 -> 已成交 -> 履行中 -> 已完成，未完成前可以取消，投标结束没有成交时可以过期
+//所有LinkContract*方法都通过contractTransitions校验状态变更
+
+//合约状态
+const (
+	//已发布
+	Contract_Status_Published = "published"
+	//投标中，收到第一条投标后
+	Contract_Status_Bidding = "bidding"
+	//已成交
+	Contract_Status_Awarded = "awarded"
+	//履行中
+	Contract_Status_InProgress = "in_progress"
+	//已完成
+	Contract_Status_Completed = "completed"
+	//已取消
+	Contract_Status_Cancelled = "cancelled"
+	//已过期，投标结束没有成交
+	Contract_Status_Expired = "expired"
+)
+
+//状态名，用于错误信息
+var contractStatusNames = map[string]string{
+	Contract_Status_Published:  "已发布",
+	Contract_Status_Bidding:    "投标中",
+	Contract_Status_Awarded:    "已成交",
+	Contract_Status_InProgress: "履行中",
+	Contract_Status_Completed:  "已完成",
+	Contract_Status_Cancelled:  "已取消",
+	Contract_Status_Expired:    "已过期",
+}
+
+//合法的状态变更，空表示新建
+//投标中可以继续投标，状态不变
+var contractTransitions = map[string][]string{
+	"":                         {Contract_Status_Published},
+	Contract_Status_Published:  {Contract_Status_Bidding, Contract_Status_Cancelled, Contract_Status_Expired},
+	Contract_Status_Bidding:    {Contract_Status_Bidding, Contract_Status_Awarded, Contract_Status_Cancelled, Contract_Status_Expired},
+	Contract_Status_Awarded:    {Contract_Status_InProgress, Contract_Status_Cancelled},
+	Contract_Status_InProgress: {Contract_Status_Completed, Contract_Status_Cancelled},
+}
+
+//旧版本的状态，读取时转换
+var legacyContractStatus = map[string]string{
+	"yes":   Contract_Status_Published,
+	"deal":  Contract_Status_Awarded,
+	"close": Contract_Status_Cancelled,
+}
+
+//校验状态变更
+func checkTransition(from string, to string) error {
+	for _, status := range contractTransitions[from] {
+		if status == to {
+			return nil
+		}
+	}
+	if from == "" {
+		return fmt.Errorf("合约不能新建为%s", contractStatusNames[to])
+	}
+	return fmt.Errorf("合约状态为%s，不能变更为%s", contractStatusNames[from], contractStatusNames[to])
+}
+
+//变更合约状态
+func transitBill(bill *Bill, to string) error {
+	if err := checkTransition(bill.ContractStatus, to); err != nil {
+		return err
+	}
+	bill.ContractStatus = to
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fabric_asset/client"
+	"testing"
+)
+
+func TestCheckTransition(t *testing.T) {
+	cases := []struct {
+		from  string
+		to    string
+		valid bool
+	}{
+		{"", Contract_Status_Published, true},
+		{"", Contract_Status_Bidding, false},
+		{Contract_Status_Published, Contract_Status_Bidding, true},
+		{Contract_Status_Published, Contract_Status_Awarded, false},
+		{Contract_Status_Published, Contract_Status_Expired, true},
+		{Contract_Status_Bidding, Contract_Status_Bidding, true},
+		{Contract_Status_Bidding, Contract_Status_Awarded, true},
+		{Contract_Status_Bidding, Contract_Status_InProgress, false},
+		{Contract_Status_Awarded, Contract_Status_InProgress, true},
+		{Contract_Status_Awarded, Contract_Status_Expired, false},
+		{Contract_Status_InProgress, Contract_Status_Completed, true},
+		{Contract_Status_InProgress, Contract_Status_Cancelled, true},
+		{Contract_Status_Completed, Contract_Status_Cancelled, false},
+		{Contract_Status_Cancelled, Contract_Status_Bidding, false},
+		{Contract_Status_Expired, Contract_Status_Awarded, false},
+	}
+	for _, c := range cases {
+		err := checkTransition(c.from, c.to)
+		if c.valid && err != nil {
+			t.Errorf("%q -> %q: %s", c.from, c.to, err)
+		} else if !c.valid && err == nil {
+			t.Errorf("%q -> %q 应返回错误", c.from, c.to)
+		}
+	}
+}
+
+func TestContractLifecycle(t *testing.T) {
+	s := newTestStub(t)
+	s.createBill("C1", Bid_Mode_Open)
+	deal := toJSON(t, BillDeal{UserCode: "pub", ContractCode: "C1", WinnerUserCode: "s1"})
+	start := toJSON(t, BillStart{UserCode: "pub", ContractCode: "C1"})
+	confirm := toJSON(t, BillConfirm{UserCode: "buyer", ContractCode: "C1"})
+	complete := toJSON(t, BillClose{UserCode: "pub", ContractCode: "C1", Reason: "履行完毕", ContractStatus: Contract_Status_Completed})
+	cancel := toJSON(t, BillClose{UserCode: "pub", ContractCode: "C1", Reason: "取消", ContractStatus: Contract_Status_Cancelled})
+
+	if bill := s.lastBill("C1"); bill.ContractStatus != Contract_Status_Published {
+		t.Fatalf("新合约状态为%s", bill.ContractStatus)
+	}
+	//重复发布
+	s.as("pub").expectCode(client.Code_Already_Exists, "link_contract_create", toJSON(t, Bill{
+		UserCode:         "pub",
+		ContractCode:     "C1",
+		PurchaseUserCode: "buyer",
+		BidingStartTime:  "2018-06-01 00:00:00",
+		BidingEndTime:    "2018-06-10 00:00:00",
+	}))
+	//没有成交不能开始履行
+	s.as("pub").expectCode(client.Code_Illegal_Transition, "link_contract_start", start)
+
+	s.at("2018-06-02 00:00:00")
+	s.bid("C1", "s1", 100)
+	if bill := s.lastBill("C1"); bill.ContractStatus != Contract_Status_Bidding {
+		t.Fatalf("投标后合约状态为%s", bill.ContractStatus)
+	}
+
+	s.at("2018-06-10 00:00:00")
+	s.as("pub").mustInvoke(nil, "link_contract_deal", deal)
+	//不能重复成交
+	s.as("pub").expectCode(client.Code_Illegal_Transition, "link_contract_deal", deal)
+	//采购方确认前不能开始履行
+	s.as("pub").expectCode(client.Code_Illegal_Transition, "link_contract_start", start)
+	//只有采购方可以确认
+	s.as("pub").expectCode(client.Code_Permission_Denied, "link_contract_confirm", toJSON(t, BillConfirm{UserCode: "pub", ContractCode: "C1"}))
+	s.as("buyer").mustInvoke(nil, "link_contract_confirm", confirm)
+	s.as("buyer").expectCode(client.Code_Already_Exists, "link_contract_confirm", confirm)
+
+	s.as("pub").mustInvoke(nil, "link_contract_start", start)
+	if bill := s.lastBill("C1"); bill.ContractStatus != Contract_Status_InProgress {
+		t.Fatalf("开始履行后合约状态为%s", bill.ContractStatus)
+	}
+	s.as("pub").mustInvoke(nil, "link_contract_close", complete)
+
+	//已完成的合约不能再变更
+	bill := s.lastBill("C1")
+	if bill.ContractStatus != Contract_Status_Completed || bill.ClosedBy != testMSP+"/pub" || bill.CloseReason != "履行完毕" {
+		t.Errorf("完成后的合约错误：%+v", bill)
+	}
+	s.as("pub").expectCode(client.Code_Illegal_Transition, "link_contract_close", cancel)
+	s.as("s2").expectCode(client.Code_Illegal_Transition, "link_contract_biding", toJSON(t, BidingBill{UserCode: "s2", ContractCode: "C1", Amount: 90}))
+}
+
+func TestCancelledContractRejectsBids(t *testing.T) {
+	s := newTestStub(t)
+	s.createBill("C1", Bid_Mode_Open)
+	cancel := toJSON(t, BillClose{UserCode: "pub", ContractCode: "C1", Reason: "需求变更", ContractStatus: Contract_Status_Cancelled})
+
+	//只有发布方可以关闭，关闭原因必填
+	s.as("buyer").expectCode(client.Code_Permission_Denied, "link_contract_close", toJSON(t, BillClose{UserCode: "buyer", ContractCode: "C1", Reason: "需求变更", ContractStatus: Contract_Status_Cancelled}))
+	s.as("pub").expectCode(client.Code_Invalid_Argument, "link_contract_close", toJSON(t, BillClose{UserCode: "pub", ContractCode: "C1", ContractStatus: Contract_Status_Cancelled}))
+	s.as("pub").mustInvoke(nil, "link_contract_close", cancel)
+
+	s.at("2018-06-02 00:00:00")
+	s.as("s1").expectCode(client.Code_Illegal_Transition, "link_contract_biding", toJSON(t, BidingBill{UserCode: "s1", ContractCode: "C1", Amount: 100}))
+	s.as("pub").expectCode(client.Code_Illegal_Transition, "link_contract_close", cancel)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"time"
+)
+
+//投标时间窗口
+//合约中的时间统一为Time_Layout格式，按UTC解释，与交易时间比较
+
+const Time_Layout = "2006-01-02 15:04:05"
+
+//解析合约中的时间
+func parseBillTime(value string) (time.Time, error) {
+	return time.ParseInLocation(Time_Layout, value, time.UTC)
+}
+
+//取交易时间，各背书节点一致
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("获取交易时间失败")
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
+
+//发布合约时校验时间
+//投标开始和结束时间必填，其余时间填写时必须符合格式
+func checkBillTimes(bill Bill) error {
+	bidingStart, err := parseBillTime(bill.BidingStartTime)
+	if err != nil {
+		return fmt.Errorf("投标开始时间格式错误，应为%s", Time_Layout)
+	}
+	bidingEnd, err := parseBillTime(bill.BidingEndTime)
+	if err != nil {
+		return fmt.Errorf("投标结束时间格式错误，应为%s", Time_Layout)
+	}
+	if !bidingStart.Before(bidingEnd) {
+		return fmt.Errorf("投标开始时间必须早于结束时间")
+	}
+	//密封投标需要揭标时间
+	if bill.BidMode == Bid_Mode_Sealed {
+		revealEnd, err := parseBillTime(bill.RevealEndTime)
+		if err != nil {
+			return fmt.Errorf("揭标结束时间格式错误，应为%s", Time_Layout)
+		}
+		if !bidingEnd.Before(revealEnd) {
+			return fmt.Errorf("投标结束时间必须早于揭标结束时间")
+		}
+	} else if bill.RevealEndTime != "" {
+		return fmt.Errorf("公开投标不需要揭标结束时间")
+	}
+
+	var contractStart, contractEnd time.Time
+	if bill.ContractStartTime != "" {
+		if contractStart, err = parseBillTime(bill.ContractStartTime); err != nil {
+			return fmt.Errorf("合同开始时间格式错误，应为%s", Time_Layout)
+		}
+	}
+	if bill.ContractEndTime != "" {
+		if contractEnd, err = parseBillTime(bill.ContractEndTime); err != nil {
+			return fmt.Errorf("合同结束时间格式错误，应为%s", Time_Layout)
+		}
+	}
+	if bill.ContractStartTime != "" && bill.ContractEndTime != "" && !contractStart.Before(contractEnd) {
+		return fmt.Errorf("合同开始时间必须早于结束时间")
+	}
+	if bill.CloseTime != "" {
+		if _, err = parseBillTime(bill.CloseTime); err != nil {
+			return fmt.Errorf("关闭时间格式错误，应为%s", Time_Layout)
+		}
+	}
+	return nil
+}
+
+//交易时间是否在投标时间内，包含开始不包含结束
+func inBidingWindow(bill Bill, t time.Time) bool {
+	start, err := parseBillTime(bill.BidingStartTime)
+	if err != nil {
+		return false
+	}
+	end, err := parseBillTime(bill.BidingEndTime)
+	if err != nil {
+		return false
+	}
+	return !t.Before(start) && t.Before(end)
+}
+
+//投标时间是否已经结束
+func bidingClosed(bill Bill, t time.Time) bool {
+	end, err := parseBillTime(bill.BidingEndTime)
+	if err != nil {
+		return false
+	}
+	return !t.Before(end)
+}
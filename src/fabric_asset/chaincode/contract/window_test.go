@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fabric_asset/client"
+	"testing"
+)
+
+func TestCheckBillTimes(t *testing.T) {
+	cases := []struct {
+		name  string
+		bill  Bill
+		valid bool
+	}{
+		{"公开投标", Bill{BidingStartTime: "2018-06-01 00:00:00", BidingEndTime: "2018-06-10 00:00:00"}, true},
+		{"缺少投标结束时间", Bill{BidingStartTime: "2018-06-01 00:00:00"}, false},
+		{"时间格式错误", Bill{BidingStartTime: "2018/06/01", BidingEndTime: "2018-06-10 00:00:00"}, false},
+		{"开始晚于结束", Bill{BidingStartTime: "2018-06-10 00:00:00", BidingEndTime: "2018-06-01 00:00:00"}, false},
+		{"开始等于结束", Bill{BidingStartTime: "2018-06-01 00:00:00", BidingEndTime: "2018-06-01 00:00:00"}, false},
+		{"公开投标不需要揭标时间", Bill{BidingStartTime: "2018-06-01 00:00:00", BidingEndTime: "2018-06-10 00:00:00", RevealEndTime: "2018-06-15 00:00:00"}, false},
+		{"密封投标", Bill{BidMode: Bid_Mode_Sealed, BidingStartTime: "2018-06-01 00:00:00", BidingEndTime: "2018-06-10 00:00:00", RevealEndTime: "2018-06-15 00:00:00"}, true},
+		{"密封投标缺少揭标时间", Bill{BidMode: Bid_Mode_Sealed, BidingStartTime: "2018-06-01 00:00:00", BidingEndTime: "2018-06-10 00:00:00"}, false},
+		{"揭标早于投标结束", Bill{BidMode: Bid_Mode_Sealed, BidingStartTime: "2018-06-01 00:00:00", BidingEndTime: "2018-06-10 00:00:00", RevealEndTime: "2018-06-09 00:00:00"}, false},
+		{"合同开始晚于结束", Bill{BidingStartTime: "2018-06-01 00:00:00", BidingEndTime: "2018-06-10 00:00:00", ContractStartTime: "2018-08-01 00:00:00", ContractEndTime: "2018-07-01 00:00:00"}, false},
+	}
+	for _, c := range cases {
+		err := checkBillTimes(c.bill)
+		if c.valid && err != nil {
+			t.Errorf("%s: %s", c.name, err)
+		} else if !c.valid && err == nil {
+			t.Errorf("%s: 应返回错误", c.name)
+		}
+	}
+}
+
+func TestBidingWindow(t *testing.T) {
+	bill := Bill{BidingStartTime: "2018-06-01 00:00:00", BidingEndTime: "2018-06-10 00:00:00"}
+	cases := []struct {
+		time   string
+		open   bool
+		closed bool
+	}{
+		{"2018-05-31 23:59:59", false, false},
+		{"2018-06-01 00:00:00", true, false},
+		{"2018-06-09 23:59:59", true, false},
+		{"2018-06-10 00:00:00", false, true},
+		{"2018-06-11 00:00:00", false, true},
+	}
+	for _, c := range cases {
+		txTime, err := parseBillTime(c.time)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inBidingWindow(bill, txTime) != c.open {
+			t.Errorf("%s: 是否在投标时间内应为%v", c.time, c.open)
+		}
+		if bidingClosed(bill, txTime) != c.closed {
+			t.Errorf("%s: 投标是否结束应为%v", c.time, c.closed)
+		}
+	}
+}
+
+func TestBidingWindowEnforced(t *testing.T) {
+	s := newTestStub(t)
+	s.createBill("C1", Bid_Mode_Open)
+	bid := toJSON(t, BidingBill{UserCode: "s1", ContractCode: "C1", Amount: 100})
+	deal := toJSON(t, BillDeal{UserCode: "pub", ContractCode: "C1", WinnerUserCode: "s1"})
+	expire := toJSON(t, BillClose{UserCode: "pub", ContractCode: "C1", Reason: "无人中标", ContractStatus: Contract_Status_Expired})
+
+	//投标开始前不能投标
+	s.at("2018-05-31 23:59:59")
+	s.as("s1").expectCode(client.Code_Out_Of_Window, "link_contract_biding", bid)
+
+	//开始时刻可以投标，投标结束前不能成交或过期
+	s.at("2018-06-01 00:00:00")
+	s.as("s1").mustInvoke(nil, "link_contract_biding", bid)
+	s.at("2018-06-09 23:59:59")
+	s.as("pub").expectCode(client.Code_Out_Of_Window, "link_contract_deal", deal)
+	s.as("pub").expectCode(client.Code_Out_Of_Window, "link_contract_close", expire)
+
+	//结束时刻不能再投标，可以成交
+	s.at("2018-06-10 00:00:00")
+	s.as("s2").expectCode(client.Code_Out_Of_Window, "link_contract_biding", toJSON(t, BidingBill{UserCode: "s2", ContractCode: "C1", Amount: 90}))
+	s.as("pub").mustInvoke(nil, "link_contract_deal", deal)
+}
+
+func TestExpireAfterBidingWindow(t *testing.T) {
+	s := newTestStub(t)
+	s.createBill("C1", Bid_Mode_Open)
+	expire := toJSON(t, BillClose{UserCode: "pub", ContractCode: "C1", Reason: "无人投标", ContractStatus: Contract_Status_Expired})
+
+	s.at("2018-06-05 00:00:00")
+	s.as("pub").expectCode(client.Code_Out_Of_Window, "link_contract_close", expire)
+	s.at("2018-06-10 00:00:00")
+	s.as("pub").mustInvoke(nil, "link_contract_close", expire)
+	if bill := s.lastBill("C1"); bill.ContractStatus != Contract_Status_Expired || bill.CloseTime != "2018-06-10 00:00:00" {
+		t.Errorf("过期后的合约错误：%+v", bill)
+	}
+}
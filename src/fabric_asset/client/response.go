@@ -0,0 +1,117 @@
+//Package client 定义contract链码的统一返回结构和错误码，并提供解析方法
+//链码直接引用这里的版本和错误码；成功和失败时返回结构都在payload中，失败时错误信息为纯文本
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+//返回结构的版本，结构变化时增加
+const Response_Version = 1
+
+//错误码
+const (
+	//成功
+	Code_Success = 0
+	//参数错误：参数个数、必填项、取值范围
+	Code_Invalid_Argument = 1000
+	//内容格式错误：json、时间、哈希等格式不对
+	Code_Invalid_Content = 2000
+	//合约状态不允许该操作
+	Code_Illegal_Transition = 3000
+	//没有权限：提交者身份、角色不符
+	Code_Permission_Denied = 4000
+	//合约、投标、用户不存在
+	Code_Not_Found = 5000
+	//已经存在或已经处理过
+	Code_Already_Exists = 6000
+	//不在允许操作的时间内
+	Code_Out_Of_Window = 7000
+	//读写账本失败
+	Code_Ledger_Error = 8000
+	//调用支付链码付款失败
+	Code_Payment_Failed = 9000
+)
+
+//错误码说明
+var CodeMessages = map[int]string{
+	Code_Success:            "成功",
+	Code_Invalid_Argument:   "参数错误",
+	Code_Invalid_Content:    "内容格式错误",
+	Code_Illegal_Transition: "合约状态不允许该操作",
+	Code_Permission_Denied:  "没有权限",
+	Code_Not_Found:          "不存在",
+	Code_Already_Exists:     "已经存在",
+	Code_Out_Of_Window:      "不在允许的时间内",
+	Code_Ledger_Error:       "读写账本失败",
+	Code_Payment_Failed:     "付款失败",
+}
+
+//链码的返回结构
+type Response struct {
+	//返回结构的版本
+	Version int `json:"version"`
+	//1代表成功，0代表失败
+	Result int `json:"result"`
+	//错误码，0代表没有错误
+	Code int `json:"code"`
+	//提示或错误信息
+	Message string `json:"message"`
+	//返回的数据，用DecodeData解析
+	Data json.RawMessage `json:"data"`
+	//交易id
+	TxId string `json:"tx_id"`
+}
+
+//链码返回的错误
+type Error struct {
+	Code    int
+	Message string
+	TxId    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Code, CodeMessages[e.Code], e.Message)
+}
+
+//解析payload中的返回结构
+//不是返回结构或版本不支持时返回错误
+func Decode(b []byte) (*Response, error) {
+	r := &Response{}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("解析返回结构失败: %s", err)
+	}
+	if r.Version != Response_Version {
+		return nil, fmt.Errorf("不支持的返回结构版本: %d", r.Version)
+	}
+	return r, nil
+}
+
+//失败时返回*Error，成功时返回nil
+func (r *Response) Err() error {
+	if r.Result == 1 && r.Code == Code_Success {
+		return nil
+	}
+	return &Error{Code: r.Code, Message: r.Message, TxId: r.TxId}
+}
+
+//解析返回的数据，失败的返回结构直接返回*Error
+func (r *Response) DecodeData(v interface{}) error {
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if len(r.Data) == 0 || string(r.Data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(r.Data, v)
+}
+
+//解析payload中的数据
+func DecodePayload(payload []byte, v interface{}) (*Response, error) {
+	r, err := Decode(payload)
+	if err != nil {
+		return nil, err
+	}
+	return r, r.DecodeData(v)
+}
@@ -0,0 +1,37 @@
+package client
+
+import "testing"
+
+func TestDecodePayload(t *testing.T) {
+	var data struct {
+		ContractCode string `json:"contract_code"`
+	}
+	r, err := DecodePayload([]byte(`{"version":1,"result":1,"code":0,"message":"发布合约成功","data":{"contract_code":"C1"},"tx_id":"tx1"}`), &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.TxId != "tx1" || data.ContractCode != "C1" {
+		t.Errorf("解析结果错误：%+v %+v", r, data)
+	}
+}
+
+func TestDecodePayloadError(t *testing.T) {
+	var data interface{}
+	_, err := DecodePayload([]byte(`{"version":1,"result":0,"code":4000,"message":"提交者不是用户pub","data":null,"tx_id":"tx2"}`), &data)
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("失败的返回结构应返回*Error：%v", err)
+	}
+	if e.Code != Code_Permission_Denied || e.Message != "提交者不是用户pub" || e.TxId != "tx2" {
+		t.Errorf("错误内容不对：%+v", e)
+	}
+}
+
+func TestDecodeRejectsUnknownVersion(t *testing.T) {
+	if _, err := Decode([]byte(`{"version":2,"result":1}`)); err == nil {
+		t.Error("不支持的版本应返回错误")
+	}
+	if _, err := Decode([]byte(`提交者不是用户pub`)); err == nil {
+		t.Error("纯文本不是返回结构")
+	}
+}
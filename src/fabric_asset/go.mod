@@ -1 +1,3 @@
-module "fabric_asset"
\ No newline at end of file
+module fabric_asset
+
+go 1.27.1